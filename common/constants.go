@@ -10,10 +10,15 @@ const (
 	MigrationListFileName = "migration.list"
 	ChecksumsTXTFileName  = "checksums.txt"
 
+	// the origins which vouched for checksums.txt, one per line
+	ChecksumsOriginFileName = "checksums.origin"
+
 	LegacyWithoutVersion = "LEGACY_WITHOUT_VERSION"
 
-	MirrorPlaceHolder = "${MIRROR}"
-	ArchPlaceHolder   = "${ARCH}"
+	MirrorPlaceHolder  = "${MIRROR}"
+	ArchPlaceHolder    = "${ARCH}"
+	VersionPlaceHolder = "${VERSION}"
+	ModelPlaceHolder   = "${MODEL}"
 
 	InstallerName       = "installer"
 	InstallerConfigType = "conf"
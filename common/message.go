@@ -7,10 +7,13 @@ import (
 
 var EventTypes = []message_bus.EventType{
 	// check update
-	EventTypeCheckUpdateBegin, EventTypeCheckUpdateEnd, EventTypeCheckUpdateError,
+	EventTypeCheckUpdateBegin, EventTypeCheckUpdateEnd, EventTypeCheckUpdateError, EventTypeCheckUpdateNotModified,
+
+	// a release is pulled from the channel
+	EventTypeReleaseRevoked,
 
 	// download update
-	EventTypeDownloadUpdateBegin, EventTypeDownloadUpdateEnd, EventTypeDownloadUpdateError,
+	EventTypeDownloadUpdateBegin, EventTypeDownloadUpdateProgress, EventTypeDownloadUpdatePaused, EventTypeDownloadUpdateResumed, EventTypeDownloadUpdateCanceled, EventTypeDownloadUpdateEnd, EventTypeDownloadUpdateError,
 
 	// install update
 	EventTypeInstallUpdateBegin, EventTypeInstallUpdateEnd, EventTypeInstallUpdateError,
@@ -31,6 +34,29 @@ var (
 	}
 )
 
+var (
+	PropertyTypeDownloaded = message_bus.PropertyType{
+		Name:        "download:downloaded",
+		Description: utils.Ptr("bytes downloaded"),
+		Example:     utils.Ptr("104857600"),
+	}
+	PropertyTypeTotal = message_bus.PropertyType{
+		Name:        "download:total",
+		Description: utils.Ptr("size of the package in bytes, -1 if unknown"),
+		Example:     utils.Ptr("524288000"),
+	}
+	PropertyTypeSpeed = message_bus.PropertyType{
+		Name:        "download:speed",
+		Description: utils.Ptr("download speed in bytes per second"),
+		Example:     utils.Ptr("2097152"),
+	}
+	PropertyTypeETA = message_bus.PropertyType{
+		Name:        "download:eta",
+		Description: utils.Ptr("estimated seconds until the download completes, empty if unknown"),
+		Example:     utils.Ptr("200"),
+	}
+)
+
 var (
 	EventTypeCheckUpdateBegin = message_bus.EventType{
 		SourceID:         InstallerServiceName,
@@ -50,12 +76,56 @@ var (
 			PropertyTypeMessage,
 		},
 	}
+	EventTypeCheckUpdateNotModified = message_bus.EventType{
+		SourceID: InstallerServiceName,
+		Name:     "installer:check-update-not-modified",
+		PropertyTypeList: []message_bus.PropertyType{
+			PropertyTypeMessage,
+		},
+	}
+
+	EventTypeReleaseRevoked = message_bus.EventType{
+		SourceID: InstallerServiceName,
+		Name:     "installer:release-revoked",
+		PropertyTypeList: []message_bus.PropertyType{
+			PropertyTypeMessage,
+		},
+	}
 
 	EventTypeDownloadUpdateBegin = message_bus.EventType{
 		SourceID:         InstallerServiceName,
 		Name:             "installer:download-update-begin",
 		PropertyTypeList: []message_bus.PropertyType{},
 	}
+	EventTypeDownloadUpdateProgress = message_bus.EventType{
+		SourceID: InstallerServiceName,
+		Name:     "installer:download-update-progress",
+		PropertyTypeList: []message_bus.PropertyType{
+			PropertyTypeDownloaded,
+			PropertyTypeTotal,
+			PropertyTypeSpeed,
+			PropertyTypeETA,
+		},
+	}
+	EventTypeDownloadUpdatePaused = message_bus.EventType{
+		SourceID: InstallerServiceName,
+		Name:     "installer:download-update-paused",
+		PropertyTypeList: []message_bus.PropertyType{
+			PropertyTypeMessage,
+		},
+	}
+	EventTypeDownloadUpdateResumed = message_bus.EventType{
+		SourceID:         InstallerServiceName,
+		Name:             "installer:download-update-resumed",
+		PropertyTypeList: []message_bus.PropertyType{},
+	}
+	EventTypeDownloadUpdateCanceled = message_bus.EventType{
+		SourceID: InstallerServiceName,
+		Name:     "installer:download-update-canceled",
+		PropertyTypeList: []message_bus.PropertyType{
+			PropertyTypeMessage,
+		},
+	}
 	EventTypeDownloadUpdateEnd = message_bus.EventType{
 		SourceID:         InstallerServiceName,
 		Name:             "installer:download-update-end",
@@ -7,7 +7,6 @@ import (
 	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
 	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
 	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
-	"github.com/hashicorp/go-getter"
 	"go.uber.org/zap"
 )
 
@@ -24,18 +23,8 @@ func DownloadReleaseBackground(url string, version string) {
 	}
 
 	// if the background url is nil, return
-	// download a url as a file
-	getClient := getter.Client{
-		Ctx:   context.Background(),
-		Dst:   BackgroundPath(version),
-		Mode:  getter.ClientModeFile,
-		Src:   url,
-		Umask: 0o022,
-		Options: []getter.ClientOption{
-			getter.WithProgress(NewTracker(func(downloaded, totalSize int64) {})),
-		},
-	}
-	err := getClient.Get()
+	// download a url as a file, from a local mirror too
+	err := DownloadAs(context.Background(), BackgroundPath(version), url)
 	if err != nil {
 		os.Remove(BackgroundPath(version))
 		logger.Error("error when trying to download background", zap.Error(err))
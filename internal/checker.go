@@ -1,7 +1,6 @@
 package internal
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"fmt"
@@ -12,6 +11,8 @@ import (
 	"time"
 
 	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/common"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
 	"github.com/go-resty/resty/v2"
 	"gopkg.in/yaml.v3"
 )
@@ -19,10 +20,9 @@ import (
 var client = resty.New()
 
 func init() {
-	client.
-		SetRetryCount(3).
-		SetRetryWaitTime(5 * time.Second).
-		SetRetryMaxWaitTime(20 * time.Second)
+	client.SetTransport(transport)
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(checkRedirect))
+	ConfigureRetry(config.RetryInfo)
 }
 
 func WriteReleaseToLocal(release *codegen.Release, releasePath string) error {
@@ -68,7 +68,8 @@ func GetReleaseFromLocal(releasePath string) (*codegen.Release, error) {
 	return &release, nil
 }
 
-func GetReleaseFromContent(content []byte) (*codegen.Release, error) {
+// ParseRelease decodes the release manifest without validation, see GetReleaseFromContent
+func ParseRelease(content []byte) (*codegen.Release, error) {
 	// decode the yaml file
 	var release codegen.Release
 	decoder := yaml.NewDecoder(bytes.NewReader(content))
@@ -78,57 +79,137 @@ func GetReleaseFromContent(content []byte) (*codegen.Release, error) {
 	return &release, nil
 }
 
+func GetReleaseFromContent(content []byte) (*codegen.Release, error) {
+	release, err := ParseRelease(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckRelease(*release); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// GetReleaseFrom downloads the release from releaseURL. the manifest is cached on disk with its ETag and Last-Modified,
+// and only downloaded again if it has been modified since. see WithFetchResult to tell whether it is.
 func GetReleaseFrom(ctx context.Context, releaseURL string) (*codegen.Release, error) {
+	request := client.R().SetContext(ctx)
+
+	cached := loadCachedManifest(releaseURL)
+	if cached != nil {
+		if cached.ETag != "" {
+			request.SetHeader("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			request.SetHeader("If-Modified-Since", cached.LastModified)
+		}
+	}
+
 	// download content from releaseURL
-	response, err := client.R().SetContext(ctx).Get(releaseURL)
+	response, err := request.Get(releaseURL)
 	if err != nil {
 		return nil, err
 	}
 
-	if response.StatusCode() != http.StatusOK {
+	var content []byte
+	notModified := false
+
+	switch {
+	case response.StatusCode() == http.StatusNotModified && cached != nil:
+		content = cached.content
+		notModified = true
+
+		signature, err := verifyReleaseSignatureFrom(ctx, releaseURL, content, cached.signature)
+		if err != nil && cached.signature != nil {
+			// the keyring might have been rotated since the signature was cached
+			signature, err = verifyReleaseSignatureFrom(ctx, releaseURL, content, nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(signature, cached.signature) {
+			cached.signature = signature
+			saveCachedManifest(cached)
+		}
+
+	case response.StatusCode() == http.StatusOK:
+		content = response.Body()
+
+		signature, err := verifyReleaseSignatureFrom(ctx, releaseURL, content, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		saveCachedManifest(&cachedManifest{
+			URL:          releaseURL,
+			ETag:         response.Header().Get("ETag"),
+			LastModified: response.Header().Get("Last-Modified"),
+			FetchedAt:    time.Now(),
+			content:      content,
+			signature:    signature,
+		})
+
+	default:
 		return nil, fmt.Errorf("failed to get release from %s - %s", releaseURL, response.Status())
 	}
 
 	// parse release
 	var release codegen.Release
-	if err := yaml.Unmarshal(response.Body(), &release); err != nil {
+	if err := yaml.Unmarshal(content, &release); err != nil {
 		return nil, err
 	}
 
+	if err := CheckRelease(release); err != nil {
+		return nil, fmt.Errorf("%w - %s", err, releaseURL)
+	}
+
+	reportFetchResult(ctx, releaseURL, notModified)
+
 	return &release, nil
 }
 
-func GetChecksums(filepath string) (map[string]string, error) {
-	println("sum filepath", filepath)
+// GetChecksums parses checksums.txt at filepath, see ParseChecksums
+func GetChecksums(filepath string, algorithm codegen.ReleaseChecksumAlgorithm) (map[string]Checksum, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-
-	checksums := map[string]string{}
-
-	// get checksums
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		if strings.HasPrefix(line, "#") {
-			continue
-		}
+	return ParseChecksums(file, algorithm)
+}
 
-		fields := strings.Fields(line)
+// GetChecksumsFrom downloads checksums.txt from checksumsURL and returns both the raw content and the parsed checksums.
+func GetChecksumsFrom(ctx context.Context, checksumsURL string, algorithm codegen.ReleaseChecksumAlgorithm) ([]byte, map[string]Checksum, error) {
+	response, err := client.R().SetContext(ctx).Get(checksumsURL)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		if len(fields) != 2 {
-			continue
-		}
+	if response.StatusCode() != http.StatusOK {
+		return nil, nil, fmt.Errorf("failed to get checksums from %s - %s", checksumsURL, response.Status())
+	}
 
-		checksums[fields[1]] = fields[0]
+	checksums, err := ParseChecksums(bytes.NewReader(response.Body()), algorithm)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return checksums, nil
+	return response.Body(), checksums, nil
 }
 
 func GetChecksumsURL(release codegen.Release, mirror string) string {
-	return strings.TrimSuffix(mirror, "/") + release.Checksums
+	return ResolveReleaseURL(release, mirror, release.Checksums)
+}
+
+// GetChecksumOrigins returns the origins which vouched for checksums.txt in releaseDir.
+func GetChecksumOrigins(releaseDir string) ([]string, error) {
+	buf, err := os.ReadFile(filepath.Join(releaseDir, common.ChecksumsOriginFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(string(buf)), nil
 }
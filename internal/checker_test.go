@@ -4,6 +4,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
 	"github.com/IceWhaleTech/CasaOS-Installer/internal"
 	"github.com/stretchr/testify/assert"
 )
@@ -32,15 +33,15 @@ badc0ffee0ddf00d filename2.txt
 	}
 
 	// Call the function with the path to the temporary file.
-	checksums, err := internal.GetChecksums(tmpfile.Name())
+	checksums, err := internal.GetChecksums(tmpfile.Name(), codegen.Sha256)
 
 	// Assert that the function did not return an error.
 	assert.NoError(t, err)
 
 	// Assert that the function returned the expected checksums.
-	expectedChecksums := map[string]string{
-		"filename1.txt": "1234567890abcdef",
-		"filename2.txt": "badc0ffee0ddf00d",
+	expectedChecksums := map[string]internal.Checksum{
+		"filename1.txt": {Algorithm: codegen.Sha256, Sum: "1234567890abcdef"},
+		"filename2.txt": {Algorithm: codegen.Sha256, Sum: "badc0ffee0ddf00d"},
 	}
 	assert.Equal(t, expectedChecksums, checksums)
 }
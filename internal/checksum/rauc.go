@@ -1,10 +1,7 @@
 package checksum
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 
@@ -38,26 +35,6 @@ func OnlineRAUCExist(release codegen.Release) (string, error) {
 	return packageFilePath, nil
 }
 
-func VerifyChecksumByFilePath(filepath, checksum string) error {
-	file, err := os.Open(filepath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return err
-	}
-
-	buf := hash.Sum(nil)[:32]
-	if hex.EncodeToString(buf) != checksum {
-		return fmt.Errorf("checksum mismatch: expected %s, got %s", checksum, hex.EncodeToString(buf))
-	}
-
-	return nil
-}
-
 func OnlineRaucChecksumExist(release codegen.Release) (string, error) {
 	releaseDir, err := config.ReleaseDir(release)
 	if err != nil {
@@ -73,20 +50,31 @@ func OnlineRaucChecksumExist(release codegen.Release) (string, error) {
 
 	packageFilePath := filepath.Join(releaseDir, packageFilename)
 
-	checksums, err := internal.GetChecksums(filepath.Dir(packageFilePath) + "/checksums.txt")
+	checksums, err := internal.GetChecksums(filepath.Dir(packageFilePath)+"/checksums.txt", internal.ChecksumAlgorithm(release))
 	packageChecksum := checksums[packageFilename]
 
 	if err != nil {
 		return "", err
 	}
+
+	// the origins which vouched for the checksum, see service.DownloadTrustedChecksums
+	origins, err := internal.GetChecksumOrigins(releaseDir)
+	if err != nil {
+		logger.Info("no checksum origin recorded", zap.Error(err), zap.String("releaseDir", releaseDir))
+	}
+
 	// to check file exist
-	logger.Info("verify rauc checksum", zap.String("packageFilePath", packageFilePath))
+	logger.Info("verify rauc checksum", zap.String("packageFilePath", packageFilePath), zap.Strings("vouched by", origins))
 
 	if _, err := os.Stat(packageFilePath); os.IsNotExist(err) {
 		return "", fmt.Errorf("not found rauc release  package")
 	}
 
-	return packageFilePath, VerifyChecksumByFilePath(packageFilePath, packageChecksum)
+	if err := internal.VerifyChecksum(packageFilePath, packageChecksum); err != nil {
+		return packageFilePath, fmt.Errorf("%w (vouched by %v)", err, origins)
+	}
+
+	return packageFilePath, nil
 }
 
 func OfflineTarExist(release codegen.Release) (string, error) {
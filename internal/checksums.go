@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"golang.org/x/crypto/blake2b"
+)
+
+var ErrChecksumMismatch = fmt.Errorf("checksum mismatch")
+
+// DefaultChecksumAlgorithm is the algorithm of the checksums when neither the line nor the manifest names one.
+const DefaultChecksumAlgorithm = codegen.Sha256
+
+var ChecksumAlgorithms = []codegen.ReleaseChecksumAlgorithm{codegen.Sha256, codegen.Sha512, codegen.Blake2b}
+
+// the tags of BSD-style lines, like `SHA256 (file) = hash`. b2sum tags the size too, like `BLAKE2b-256`
+var checksumTags = map[string]codegen.ReleaseChecksumAlgorithm{
+	"SHA256":  codegen.Sha256,
+	"SHA512":  codegen.Sha512,
+	"BLAKE2B": codegen.Blake2b,
+}
+
+// Checksum is the checksum of a file in checksums.txt, as hex.
+type Checksum struct {
+	Algorithm codegen.ReleaseChecksumAlgorithm
+	Sum       string
+}
+
+func (c Checksum) String() string {
+	return string(c.Algorithm) + ":" + c.Sum
+}
+
+// ChecksumAlgorithm returns the algorithm the manifest declares for its checksums, see DefaultChecksumAlgorithm.
+func ChecksumAlgorithm(release codegen.Release) codegen.ReleaseChecksumAlgorithm {
+	if release.ChecksumAlgorithm == nil || *release.ChecksumAlgorithm == "" {
+		return DefaultChecksumAlgorithm
+	}
+	return *release.ChecksumAlgorithm
+}
+
+// ParseChecksums parses checksums.txt as written by sha256sum, sha512sum and b2sum, with or without `--tag`. the
+// lines which do not name their algorithm are taken as algorithm. returns the checksums by file name.
+func ParseChecksums(reader io.Reader, algorithm codegen.ReleaseChecksumAlgorithm) (map[string]Checksum, error) {
+	scanner := bufio.NewScanner(reader)
+
+	checksums := map[string]Checksum{}
+
+	// get checksums
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		filename, checksum, ok := parseBSDChecksumLine(line)
+		if !ok {
+			filename, checksum, ok = parseGNUChecksumLine(line, algorithm)
+		}
+		if !ok {
+			continue
+		}
+
+		checksums[filename] = checksum
+	}
+
+	return checksums, scanner.Err()
+}
+
+// parseBSDChecksumLine parses `SHA256 (file) = hash`
+func parseBSDChecksumLine(line string) (string, Checksum, bool) {
+	tag, rest, ok := strings.Cut(line, " (")
+	if !ok || strings.ContainsAny(tag, " \t") {
+		return "", Checksum{}, false
+	}
+
+	// the file name might have ") = " in it, the hash does not
+	index := strings.LastIndex(rest, ") = ")
+	if index < 0 {
+		return "", Checksum{}, false
+	}
+	filename, sum := rest[:index], rest[index+len(") = "):]
+
+	name, _, _ := strings.Cut(tag, "-")
+	algorithm, ok := checksumTags[strings.ToUpper(name)]
+	if !ok {
+		// kept, so that verifying the file fails rather than it being unlisted
+		algorithm = codegen.ReleaseChecksumAlgorithm(strings.ToLower(tag))
+	}
+
+	return filename, Checksum{Algorithm: algorithm, Sum: strings.ToLower(sum)}, filename != "" && sum != ""
+}
+
+// parseGNUChecksumLine parses `hash  file` and `hash *file`, the latter being binary mode
+func parseGNUChecksumLine(line string, algorithm codegen.ReleaseChecksumAlgorithm) (string, Checksum, bool) {
+	index := strings.IndexAny(line, " \t")
+	if index < 0 {
+		return "", Checksum{}, false
+	}
+
+	sum := line[:index]
+	filename := strings.TrimPrefix(strings.TrimLeft(line[index:], " \t"), "*")
+	if filename == "" {
+		return "", Checksum{}, false
+	}
+
+	return filename, Checksum{Algorithm: algorithm, Sum: strings.ToLower(sum)}, true
+}
+
+func newChecksumHash(checksum Checksum) (hash.Hash, error) {
+	switch checksum.Algorithm {
+	case codegen.Sha256:
+		return sha256.New(), nil
+	case codegen.Sha512:
+		return sha512.New(), nil
+	case codegen.Blake2b:
+		// b2sum can be asked for a shorter hash, which is not a prefix of the longer one
+		size := len(checksum.Sum) / 2
+		if size < 1 || size > blake2b.Size {
+			return nil, fmt.Errorf("invalid %s checksum %s", checksum.Algorithm, checksum.Sum)
+		}
+		return blake2b.New(size, nil)
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm %s", checksum.Algorithm)
+	}
+}
+
+// VerifyChecksum returns ErrChecksumMismatch if the file does not match the checksum.
+func VerifyChecksum(filepath string, checksum Checksum) error {
+	if checksum.Algorithm == "" {
+		checksum.Algorithm = DefaultChecksumAlgorithm
+	}
+
+	hash, err := newChecksumHash(checksum)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(actual, checksum.Sum) {
+		return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, checksum, Checksum{Algorithm: checksum.Algorithm, Sum: actual})
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package internal_test
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestParseChecksums(t *testing.T) {
+	content := strings.Join([]string{
+		"# sha512sum, b2sum and --tag",
+		"AAAA  text mode.raucb",
+		"bbbb *binary.raucb",
+		"cccc\ttab.raucb",
+		"SHA256 (bsd.raucb) = dddd",
+		"SHA512 (bsd (1).raucb) = eeee",
+		"BLAKE2b-256 (b2sum.raucb) = ffff",
+		"MD5 (md5.raucb) = 0000",
+		"garbage",
+		"",
+	}, "\n")
+
+	checksums, err := internal.ParseChecksums(strings.NewReader(content), codegen.Sha512)
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]internal.Checksum{
+		"text mode.raucb": {Algorithm: codegen.Sha512, Sum: "aaaa"},
+		"binary.raucb":    {Algorithm: codegen.Sha512, Sum: "bbbb"},
+		"tab.raucb":       {Algorithm: codegen.Sha512, Sum: "cccc"},
+		"bsd.raucb":       {Algorithm: codegen.Sha256, Sum: "dddd"},
+		"bsd (1).raucb":   {Algorithm: codegen.Sha512, Sum: "eeee"},
+		"b2sum.raucb":     {Algorithm: codegen.Blake2b, Sum: "ffff"},
+		"md5.raucb":       {Algorithm: "md5", Sum: "0000"},
+	}, checksums)
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	content := []byte("package")
+
+	path := filepath.Join(t.TempDir(), "zimaos.raucb")
+	assert.NoError(t, os.WriteFile(path, content, 0o600))
+
+	sha256Sum := sha256.Sum256(content)
+	sha512Sum := sha512.Sum512(content)
+	blake2bSum := blake2b.Sum512(content)
+	blake2b256Sum := blake2b.Sum256(content)
+
+	for _, checksum := range []internal.Checksum{
+		{Algorithm: codegen.Sha256, Sum: hex.EncodeToString(sha256Sum[:])},
+		{Algorithm: codegen.Sha256, Sum: strings.ToUpper(hex.EncodeToString(sha256Sum[:]))},
+		{Sum: hex.EncodeToString(sha256Sum[:])},
+		{Algorithm: codegen.Sha512, Sum: hex.EncodeToString(sha512Sum[:])},
+		{Algorithm: codegen.Blake2b, Sum: hex.EncodeToString(blake2bSum[:])},
+		{Algorithm: codegen.Blake2b, Sum: hex.EncodeToString(blake2b256Sum[:])},
+	} {
+		assert.NoError(t, internal.VerifyChecksum(path, checksum), checksum.String())
+	}
+
+	// the sum of another algorithm does not match
+	assert.ErrorIs(t, internal.VerifyChecksum(path, internal.Checksum{Algorithm: codegen.Sha512, Sum: hex.EncodeToString(blake2bSum[:])}), internal.ErrChecksumMismatch)
+
+	assert.ErrorContains(t, internal.VerifyChecksum(path, internal.Checksum{Algorithm: "md5", Sum: "0000"}), "unsupported checksum algorithm")
+}
+
+func TestChecksumAlgorithm(t *testing.T) {
+	assert.Equal(t, codegen.Sha256, internal.ChecksumAlgorithm(codegen.Release{}))
+
+	algorithm := codegen.Blake2b
+	assert.Equal(t, codegen.Blake2b, internal.ChecksumAlgorithm(codegen.Release{ChecksumAlgorithm: &algorithm}))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/ini.v1"
 
@@ -24,8 +25,77 @@ type APPModel struct {
 type ServerModel struct {
 	Mirrors     []string `ini:"mirrors,,allowshadow"`
 	CachePath   string
-	BestURL     string
 	ReleasePath string
+
+	// checksums.txt is fetched from these origins instead of the package mirror.
+	// if empty, it is fetched from Mirrors. all origins that answer have to agree.
+	ChecksumOrigins []string `ini:"checksum_origins,,allowshadow"`
+
+	// how many origins have to vouch for the checksum, at least one.
+	ChecksumQuorum int `ini:"checksum_quorum"`
+
+	// allow to install a version older than the current one with `POST /release?version=`
+	AllowDowngrade bool
+}
+
+type SecurityModel struct {
+	Keyring []string `ini:"keyring,,allowshadow"`
+}
+
+// the limits of downloads started in background, downloads started by the user are not limited.
+type DownloadModel struct {
+	// in KiB/s, 0 for unlimited
+	MaxRate int64
+
+	// local time ranges like `01:00-06:00` which downloads are allowed in, at any time if empty
+	Windows []string `ini:"windows,,allowshadow"`
+
+	// in MiB, kept free on the filesystem of the cache after a download
+	Headroom int64
+}
+
+// the proxy and CA of all outbound requests, the proxy is taken from the environment if empty.
+type NetworkModel struct {
+	// `http://`, `https://` or `socks5://` URL of the proxy for http and https requests
+	HTTPProxy  string `ini:"http_proxy"`
+	HTTPSProxy string `ini:"https_proxy"`
+
+	// hosts, domains like `.lan` and CIDRs which are requested without proxy
+	NoProxy []string `ini:"no_proxy,,allowshadow"`
+
+	// PEM file of CAs trusted in addition to the system ones, e.g. of a TLS-intercepting proxy
+	CABundle string `ini:"ca_bundle"`
+}
+
+// sharing of cached releases with other installers on the LAN
+type ShareModel struct {
+	// serve the verified cached releases, and advertise them with mDNS
+	Enabled bool
+
+	// serve the verified cached releases as a mirror, which other devices can have in their `mirrors`
+	Mirror bool
+
+	Port int
+
+	// host:port of peers to download from, in addition to the ones found with mDNS
+	Peers []string `ini:"peers,,allowshadow"`
+}
+
+// the retry policy of all outbound requests, and the circuit breaker of mirrors
+type RetryModel struct {
+	// attempts of a request or download, including the first one
+	Attempts int
+
+	// the wait before a retry, doubled for each one up to MaxWaitTime
+	WaitTime    time.Duration
+	MaxWaitTime time.Duration
+
+	// of a HEAD request to probe a mirror or a package
+	ProbeTimeout time.Duration
+
+	// a mirror is skipped for BreakerCooldown after this many consecutive failures
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
 }
 
 const InstallerConfigFilePath = "/etc/casaos/installer.conf"
@@ -52,6 +122,28 @@ var (
 		ReleasePath: "/var/lib/casaos/release.yaml",
 	}
 
+	// release manifests must be signed by one of the keys in keyring. empty keyring disables the verification.
+	SecurityInfo = &SecurityModel{}
+
+	DownloadInfo = &DownloadModel{
+		Headroom: 256,
+	}
+
+	NetworkInfo = &NetworkModel{}
+
+	ShareInfo = &ShareModel{
+		Port: 8339,
+	}
+
+	RetryInfo = &RetryModel{
+		Attempts:         4,
+		WaitTime:         5 * time.Second,
+		MaxWaitTime:      20 * time.Second,
+		ProbeTimeout:     5 * time.Second,
+		BreakerThreshold: 3,
+		BreakerCooldown:  5 * time.Minute,
+	}
+
 	Cfg            *ini.File
 	ConfigFilePath string
 )
@@ -88,6 +180,11 @@ func InitSetup(config string) {
 	mapTo("common", CommonInfo)
 	mapTo("app", AppInfo)
 	mapTo("server", ServerInfo)
+	mapTo("security", SecurityInfo)
+	mapTo("download", DownloadInfo)
+	mapTo("network", NetworkInfo)
+	mapTo("share", ShareInfo)
+	mapTo("retry", RetryInfo)
 }
 
 func mapTo(section string, v interface{}) {
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+)
+
+// the command to apply each type of delta with
+var deltaTools = map[codegen.DeltaType]string{
+	codegen.Bsdiff:  "bspatch",
+	codegen.Xdelta3: "xdelta3",
+}
+
+// DeltaSupported returns true if the tool for the type of delta is installed.
+func DeltaSupported(deltaType codegen.DeltaType) bool {
+	tool, ok := deltaTools[deltaType]
+	if !ok {
+		return false
+	}
+
+	_, err := exec.LookPath(tool)
+	return err == nil
+}
+
+// ApplyDelta reconstructs outPath from basePath and the delta at deltaPath. outPath is removed on failure.
+func ApplyDelta(ctx context.Context, deltaType codegen.DeltaType, basePath, deltaPath, outPath string) error {
+	var cmd *exec.Cmd
+
+	switch deltaType {
+	case codegen.Bsdiff:
+		cmd = exec.CommandContext(ctx, deltaTools[deltaType], basePath, outPath, deltaPath)
+	case codegen.Xdelta3:
+		cmd = exec.CommandContext(ctx, deltaTools[deltaType], "-d", "-f", "-s", basePath, deltaPath, outPath)
+	default:
+		return fmt.Errorf("unsupported delta type: %s", deltaType)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(outPath)
+		return fmt.Errorf("failed to apply %s delta: %w - %s", deltaType, err, output)
+	}
+
+	return nil
+}
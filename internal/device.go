@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"gopkg.in/ini.v1"
+)
+
+var (
+	dmiProductNamePath  = "/sys/class/dmi/id/product_name"
+	deviceTreeModelPath = "/proc/device-tree/model"
+
+	// relative to config.SysRoot
+	raucSystemConfPath = "etc/rauc/system.conf"
+)
+
+// Device is what a package is matched against, see SelectPackage
+type Device struct {
+	Architecture string
+	Model        string
+	Compatible   string
+}
+
+func CurrentDevice() Device {
+	return Device{
+		Architecture: CurrentArchitecture(),
+		Model:        DeviceModel(),
+		Compatible:   RAUCCompatible(config.SysRoot),
+	}
+}
+
+// NormalizeModel lower cases the model and replaces spaces with `-`, so that it can go into an url.
+func NormalizeModel(model string) string {
+	return strings.Join(strings.Fields(strings.ToLower(model)), "-")
+}
+
+// DeviceModel returns the model of the device, normalized by NormalizeModel.
+// it is read from DMI on x86 and from the device tree on ARM boards. empty if neither is available.
+func DeviceModel() string {
+	for _, path := range []string{dmiProductNamePath, deviceTreeModelPath} {
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		// device tree strings are NUL terminated
+		model := strings.TrimSpace(strings.Trim(string(buf), "\x00"))
+		if model == "" {
+			continue
+		}
+
+		return NormalizeModel(model)
+	}
+
+	return ""
+}
+
+// MachineID returns the machine id of the system under sysRoot, empty if there is none.
+func MachineID(sysRoot string) string {
+	for _, path := range []string{"etc/machine-id", "var/lib/dbus/machine-id"} {
+		buf, err := os.ReadFile(filepath.Join(sysRoot, path))
+		if err != nil {
+			continue
+		}
+
+		if id := strings.TrimSpace(string(buf)); id != "" {
+			return id
+		}
+	}
+
+	return ""
+}
+
+// RAUCCompatible returns the compatible string in the RAUC system config under sysRoot, empty if RAUC is not set up.
+func RAUCCompatible(sysRoot string) string {
+	cfg, err := ini.Load(filepath.Join(sysRoot, raucSystemConfPath))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(cfg.Section("system").Key("compatible").String())
+}
+
+func (d Device) String() string {
+	return fmt.Sprintf("architecture `%s`, model `%s`, compatible `%s`", d.Architecture, d.Model, d.Compatible)
+}
@@ -0,0 +1,52 @@
+package internal_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectPackage(t *testing.T) {
+	release := codegen.Release{
+		Packages: []codegen.Package{
+			{Architecture: codegen.Amd64, Path: "/generic-amd64.raucb"},
+			{Architecture: codegen.Amd64, Model: lo.ToPtr("ZimaBoard 2"), Path: "/zimaboard2.raucb"},
+			{Architecture: codegen.Any, Compatible: lo.ToPtr("zimaos-zimacube"), Path: "/zimacube.raucb"},
+			{Architecture: codegen.Arm64, Path: "/generic-arm64.raucb"},
+		},
+	}
+
+	pathFor := func(device internal.Device) string {
+		pkg, ok := internal.SelectPackage(release, device)
+		if !ok {
+			return ""
+		}
+		return pkg.Path
+	}
+
+	assert.Equal(t, "/generic-amd64.raucb", pathFor(internal.Device{Architecture: "amd64", Model: "some-pc"}))
+	assert.Equal(t, "/zimaboard2.raucb", pathFor(internal.Device{Architecture: "amd64", Model: "zimaboard-2"}))
+	assert.Equal(t, "/zimacube.raucb", pathFor(internal.Device{Architecture: "amd64", Model: "zimaboard-2", Compatible: "zimaos-zimacube"}))
+	assert.Equal(t, "/generic-arm64.raucb", pathFor(internal.Device{Architecture: "arm64", Model: "zimaboard-2"}))
+	assert.Equal(t, "", pathFor(internal.Device{Architecture: "arm-7"}))
+}
+
+func TestRAUCCompatible(t *testing.T) {
+	sysRoot := t.TempDir()
+	assert.Equal(t, "", internal.RAUCCompatible(sysRoot))
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(sysRoot, "etc", "rauc"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(sysRoot, "etc", "rauc", "system.conf"), []byte(`[system]
+compatible=zimaos-zimacube
+bootloader=grub
+
+[keyring]
+path=/etc/rauc/keyring.pem
+`), 0o644))
+	assert.Equal(t, "zimaos-zimacube", internal.RAUCCompatible(sysRoot))
+}
@@ -0,0 +1,280 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// a download is written to `<file>.part` until it is complete and verified
+	PartialDownloadSuffix = ".part"
+
+	// the metadata to resume `<file>.part` with, kept next to it
+	PartialDownloadMetadataSuffix = ".part.json"
+)
+
+// the connection is dropped in the middle of a download, which is resumed rather than failed.
+// errors of the request itself are retried by the client already.
+var errDownloadInterrupted = fmt.Errorf("download is interrupted")
+
+// DownloadVerifier checks a complete download before it is moved into place.
+type DownloadVerifier func(partPath string) error
+
+// partialDownload is what is needed to tell if a partial download can be resumed.
+type partialDownload struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+
+	// the size of the complete file, -1 if the server did not tell
+	Size int64 `json:"size"`
+
+	// the segments done of a segmented download, which has no URL. see DownloadSegmented
+	Segments []bool `json:"segments,omitempty"`
+}
+
+// IsPartialDownload returns true if the file is a partial download or its metadata, see PartialDownloadSuffix.
+func IsPartialDownload(path string) bool {
+	return strings.HasSuffix(path, PartialDownloadSuffix) || strings.HasSuffix(path, PartialDownloadMetadataSuffix)
+}
+
+func Download(ctx context.Context, outDir, url string, verifiers ...DownloadVerifier) (string, error) {
+	filename := filepath.Base(url)
+	_filepath := filepath.Join(outDir, filename)
+
+	return _filepath, DownloadAs(ctx, _filepath, url, verifiers...)
+}
+
+// DownloadAs downloads url to filePath through `<filePath>.part`, which is resumed with a Range request across
+// attempts of the retry policy and restarts. the file is moved into place only after its size and all verifiers pass.
+func DownloadAs(ctx context.Context, filePath, url string, verifiers ...DownloadVerifier) error {
+	logger.Info("Downloading package", zap.String("url", url), zap.String("filepath", filePath))
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+
+	partPath := filePath + PartialDownloadSuffix
+
+	limiter := downloadLimiterFrom(ctx)
+
+	var err error
+	for attempt := 1; attempt <= retryPolicy.Attempts; {
+		if limiter != nil {
+			if err := limiter.waitForWindow(ctx); err != nil {
+				return err
+			}
+		}
+
+		if err = downloadPart(ctx, partPath, url); err == nil {
+			break
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// to be resumed in the next window, which is not a failed attempt
+		if errors.Is(err, errOutsideDownloadWindow) {
+			continue
+		}
+
+		if !errors.Is(err, errDownloadInterrupted) {
+			return err
+		}
+
+		logger.Info("download is interrupted - resuming", zap.Error(err), zap.String("url", url), zap.Int("attempt", attempt))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(RetryBackoff(attempt)):
+		}
+		attempt++
+	}
+	if err != nil {
+		return err
+	}
+
+	metadata, err := readPartialDownload(partPath)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(partPath)
+	if err != nil {
+		return err
+	}
+
+	if metadata.Size >= 0 && info.Size() != metadata.Size {
+		removePartialDownload(partPath)
+		return fmt.Errorf("size mismatch of %s: expected %d, got %d", url, metadata.Size, info.Size())
+	}
+
+	for _, verify := range verifiers {
+		if err := verify(partPath); err != nil {
+			removePartialDownload(partPath)
+			return err
+		}
+	}
+
+	if err := os.Rename(partPath, filePath); err != nil {
+		return err
+	}
+
+	os.Remove(partialDownloadMetadataPath(partPath))
+	return nil
+}
+
+// downloadPart downloads url to partPath, resuming from what is already there if the file on the server is not changed since.
+func downloadPart(ctx context.Context, partPath, url string) error {
+	var offset int64
+
+	request := client.R().SetContext(ctx).SetDoNotParseResponse(true)
+
+	metadata, err := readPartialDownload(partPath)
+	if err == nil && metadata.URL == url {
+		// a partial download cannot be resumed safely without a strong validator
+		validator := metadata.ETag
+		if validator == "" || strings.HasPrefix(validator, "W/") {
+			validator = metadata.LastModified
+		}
+
+		if info, err := os.Stat(partPath); err == nil && info.Size() > 0 && validator != "" {
+			offset = info.Size()
+			request.SetHeader("Range", fmt.Sprintf("bytes=%d-", offset))
+			request.SetHeader("If-Range", validator)
+		}
+	}
+
+	response, err := request.Get(url)
+	if err != nil {
+		return err
+	}
+
+	defer response.RawBody().Close()
+
+	flag := os.O_CREATE | os.O_WRONLY
+
+	switch response.StatusCode() {
+	case http.StatusPartialContent:
+		start, size, err := parseContentRange(response.Header().Get("Content-Range"))
+		if err != nil || start != offset {
+			removePartialDownload(partPath)
+			return fmt.Errorf("unexpected range `%s` from %s, starting over", response.Header().Get("Content-Range"), url)
+		}
+		logger.Info("resuming download", zap.String("url", url), zap.Int64("offset", offset))
+		metadata.Size = size
+		flag |= os.O_APPEND
+
+	case http.StatusOK:
+		// either a new download, or the file on the server is changed since
+		offset = 0
+		metadata.Size = response.RawResponse.ContentLength
+		flag |= os.O_TRUNC
+
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the partial download might be complete already
+		if metadata.Size == offset {
+			return nil
+		}
+		removePartialDownload(partPath)
+		return fmt.Errorf("failed to resume download of %s - %s, starting over", url, response.Status())
+
+	default:
+		return fmt.Errorf("failed to download %s - %s", url, response.Status())
+	}
+
+	metadata.URL = url
+	metadata.ETag = response.Header().Get("ETag")
+	metadata.LastModified = response.Header().Get("Last-Modified")
+
+	if err := writePartialDownload(partPath, metadata); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(partPath, flag, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var stream io.ReadCloser = response.RawBody()
+	if limiter := downloadLimiterFrom(ctx); limiter != nil {
+		stream = &limitedReader{ctx: ctx, rc: stream, limiter: limiter}
+	}
+
+	body := &readCloser{
+		rc:         stream,
+		src:        url,
+		downloaded: offset,
+		totalSize:  metadata.Size,
+		callback:   downloadProgressCallback(ctx),
+	}
+
+	if _, err := io.Copy(file, body); err != nil {
+		return fmt.Errorf("%w: %w", errDownloadInterrupted, err)
+	}
+
+	return nil
+}
+
+// parseContentRange parses `bytes <start>-<end>/<size>`, size is -1 if it is `*`.
+func parseContentRange(contentRange string) (int64, int64, error) {
+	var start, end int64
+	var size string
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%s", &start, &end, &size); err != nil {
+		return 0, 0, err
+	}
+
+	if size == "*" {
+		return start, -1, nil
+	}
+
+	var total int64
+	if _, err := fmt.Sscanf(size, "%d", &total); err != nil {
+		return 0, 0, err
+	}
+
+	return start, total, nil
+}
+
+func readPartialDownload(partPath string) (partialDownload, error) {
+	metadata := partialDownload{Size: -1}
+
+	buf, err := os.ReadFile(partialDownloadMetadataPath(partPath))
+	if err != nil {
+		return metadata, err
+	}
+
+	err = json.Unmarshal(buf, &metadata)
+	return metadata, err
+}
+
+func writePartialDownload(partPath string, metadata partialDownload) error {
+	buf, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(partialDownloadMetadataPath(partPath), buf, 0o600)
+}
+
+func removePartialDownload(partPath string) {
+	os.Remove(partPath)
+	os.Remove(partialDownloadMetadataPath(partPath))
+}
+
+func partialDownloadMetadataPath(partPath string) string {
+	return strings.TrimSuffix(partPath, PartialDownloadSuffix) + PartialDownloadMetadataSuffix
+}
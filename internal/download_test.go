@@ -0,0 +1,84 @@
+package internal_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadResume(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	etag := `"v1"`
+
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "zimaos.raucb", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	url := server.URL + "/zimaos.raucb"
+	outDir := t.TempDir()
+	filePath := filepath.Join(outDir, "zimaos.raucb")
+	partPath := filePath + internal.PartialDownloadSuffix
+	metadataPath := filePath + internal.PartialDownloadMetadataSuffix
+
+	writePartial := func(part []byte, etag string) {
+		assert.NoError(t, os.WriteFile(partPath, part, 0o644))
+		metadata := fmt.Sprintf(`{"url":%q,"etag":%q,"size":%d}`, url, etag, len(content))
+		assert.NoError(t, os.WriteFile(metadataPath, []byte(metadata), 0o600))
+	}
+
+	assertDownloaded := func() {
+		buf, err := os.ReadFile(filePath)
+		assert.NoError(t, err)
+		assert.Equal(t, content, buf)
+		assert.NoFileExists(t, partPath)
+		assert.NoFileExists(t, metadataPath)
+	}
+
+	// resumed where the last download was interrupted
+	var downloaded, totalSize int64
+	ctx := internal.WithDownloadProgress(context.Background(), func(d, t int64) {
+		downloaded, totalSize = d, t
+	})
+
+	writePartial(content[:4000], etag)
+	_, err := internal.Download(ctx, outDir, url)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bytes=4000-"}, ranges)
+	assert.Equal(t, int64(len(content)), downloaded)
+	assert.Equal(t, int64(len(content)), totalSize)
+	assertDownloaded()
+
+	// started over if the file on the server is changed since
+	ranges = nil
+	writePartial([]byte("something else"), `"v0"`)
+	_, err = internal.Download(context.Background(), outDir, url)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bytes=14-"}, ranges)
+	assertDownloaded()
+
+	// nothing is moved into place if the verification fails
+	assert.NoError(t, os.Remove(filePath))
+	_, err = internal.Download(context.Background(), outDir, url, func(partPath string) error {
+		return fmt.Errorf("checksum mismatch")
+	})
+	assert.ErrorContains(t, err, "checksum mismatch")
+	assert.NoFileExists(t, filePath)
+	assert.NoFileExists(t, partPath)
+	assert.NoFileExists(t, metadataPath)
+}
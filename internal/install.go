@@ -1,7 +1,6 @@
 package internal
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -11,7 +10,6 @@ import (
 
 	"github.com/hashicorp/go-getter"
 	"github.com/samber/lo"
-	"go.uber.org/zap"
 
 	"github.com/IceWhaleTech/CasaOS-Common/utils/file"
 	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
@@ -19,56 +17,70 @@ import (
 	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
 )
 
-func GetPackageURLByCurrentArch(release codegen.Release, mirror string) (string, error) {
-	// get current arch
+// CurrentArchitecture returns the architecture of the device in the format of codegen.PackageArchitecture
+func CurrentArchitecture() string {
 	arch := runtime.GOARCH
 
 	if arch == "arm" {
 		arch = "arm-7"
 	}
 
-	if !lo.Contains([]string{string(codegen.Amd64), string(codegen.Arm64), string(codegen.Arm7)}, arch) {
-		return "", fmt.Errorf("unsupported architecture: %s", arch)
+	return arch
+}
+
+// GetPackageURLByCurrentArch returns the url of the package for this device on the mirror, see SelectPackage.
+func GetPackageURLByCurrentArch(release codegen.Release, mirror string) (string, error) {
+	device := CurrentDevice()
+
+	if !lo.Contains([]string{string(codegen.Amd64), string(codegen.Arm64), string(codegen.Arm7)}, device.Architecture) {
+		return "", fmt.Errorf("unsupported architecture: %s", device.Architecture)
 	}
 
-	for _, pkg := range release.Packages {
-		if string(pkg.Architecture) == arch {
-			return strings.TrimSuffix(mirror, "/") + pkg.Path, nil
-		}
+	pkg, ok := SelectPackage(release, device)
+	if !ok {
+		return "", fmt.Errorf("package not found for device: %s", device)
 	}
 
-	return "", fmt.Errorf("package not found for architecture: %s", arch)
+	return ResolveReleaseURL(release, mirror, pkg.Path), nil
 }
 
-func Download(ctx context.Context, outDir, url string) (string, error) {
-	filename := filepath.Base(url)
-	_filepath := filepath.Join(outDir, filename)
+// SelectPackage returns the package for the device. a package matches if its architecture, model and compatible are
+// either not given (or `any`) or the same as the device's. the most specific one is chosen among the matches:
+// compatible goes before model, and model before architecture.
+func SelectPackage(release codegen.Release, device Device) (codegen.Package, bool) {
+	var selected codegen.Package
+	best := -1
 
-	return _filepath, DownloadAs(ctx, _filepath, url)
-}
+	for _, pkg := range release.Packages {
+		score := 0
+
+		switch {
+		case string(pkg.Architecture) == device.Architecture:
+			score++
+		case pkg.Architecture != codegen.Any:
+			continue
+		}
+
+		if pkg.Model != nil && *pkg.Model != "" {
+			if NormalizeModel(*pkg.Model) != device.Model {
+				continue
+			}
+			score += 2
+		}
+
+		if pkg.Compatible != nil && *pkg.Compatible != "" {
+			if *pkg.Compatible != device.Compatible {
+				continue
+			}
+			score += 4
+		}
+
+		if score > best {
+			selected, best = pkg, score
+		}
+	}
 
-func DownloadAs(ctx context.Context, filepath, url string) error {
-	url = url + "?archive=false" // disable automatic archive extraction
-	logger.Info("Downloading package", zap.String("url", url), zap.String("filepath", filepath))
-
-	// download package
-	getClient := getter.Client{
-		Ctx:   ctx,
-		Dst:   filepath,
-		Mode:  getter.ClientModeFile,
-		Src:   url,
-		Umask: 0o022,
-		Options: []getter.ClientOption{
-			getter.WithProgress(NewTracker(
-				func(downladed, totalSize int64) {
-					// TODO: send progress event to message bus if it exists
-					// logger.Info("Downloading package", zap.String("url", url), zap.Int64("downloaded", downladed), zap.Int64("totalSize", totalSize))
-				},
-			)),
-		},
-	}
-
-	return getClient.Get()
+	return selected, best >= 0
 }
 
 func Extract(tarFilePath, destinationFolder string) error {
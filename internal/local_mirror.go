@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+)
+
+const (
+	// FileMirrorScheme is a mirror on a local or mounted filesystem, like `file:///mnt/share/zimaos/`
+	FileMirrorScheme = "file"
+
+	// USBMirrorScheme is a mirror on removable media, like `usb://ZIMAOS/zimaos/` for the media labeled ZIMAOS, or
+	// `usb:///zimaos/` for whichever media has the path. see RemovableMediaDirs
+	USBMirrorScheme = "usb"
+)
+
+var ErrLocalMirrorNotConfigured = fmt.Errorf("local mirror is not configured in installer.conf")
+
+// RemovableMediaDirs are where removable media are mounted, either right in them or in a dir of the user.
+var RemovableMediaDirs = []string{"/media", "/mnt", "/run/media"}
+
+var fileTransport = http.NewFileTransport(http.Dir("/"))
+
+func init() {
+	// local mirrors go through the shared transport like the others, so downloads, ranges and checks are the same
+	transport.RegisterProtocol(FileMirrorScheme, configuredLocalMirrors{fileTransport})
+	transport.RegisterProtocol(USBMirrorScheme, configuredLocalMirrors{usbTransport{}})
+}
+
+// IsLocalMirror returns true if the mirror is on a filesystem of the device rather than on the network.
+func IsLocalMirror(mirror string) bool {
+	u, err := url.Parse(mirror)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == FileMirrorScheme || u.Scheme == USBMirrorScheme
+}
+
+// configuredLocalMirrors serves the local mirrors of installer.conf only, so that neither a manifest nor a redirect
+// can make the installer read any other local file.
+type configuredLocalMirrors struct {
+	next http.RoundTripper
+}
+
+func (t configuredLocalMirrors) RoundTrip(request *http.Request) (*http.Response, error) {
+	if !isConfiguredLocalMirror(request.URL) {
+		return nil, fmt.Errorf("%w: %s", ErrLocalMirrorNotConfigured, request.URL.Redacted())
+	}
+	return t.next.RoundTrip(request)
+}
+
+// isConfiguredLocalMirror returns true if u is in one of the mirrors or checksum origins of installer.conf.
+func isConfiguredLocalMirror(u *url.URL) bool {
+	requested := path.Clean("/" + u.Path)
+
+	configured := append(append([]string{}, config.ServerInfo.Mirrors...), config.ServerInfo.ChecksumOrigins...)
+	for _, mirror := range configured {
+		mirrorURL, err := url.Parse(mirror)
+		if err != nil || mirrorURL.Scheme != u.Scheme || !strings.EqualFold(mirrorURL.Host, u.Host) {
+			continue
+		}
+
+		root := path.Clean("/" + mirrorURL.Path)
+		if requested == root || strings.HasPrefix(requested, strings.TrimSuffix(root, "/")+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// usbTransport serves `usb://<label>/<path>` from the first removable media with the label which has the path.
+type usbTransport struct{}
+
+func (usbTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	path := filepath.FromSlash(request.URL.Path)
+
+	// the request fails as not found if no media has it, like any other mirror without the file
+	resolved := filepath.Join(RemovableMediaDirs[0], request.URL.Host, path)
+	for _, mountPoint := range removableMediaMountPoints(request.URL.Host) {
+		if _, err := os.Stat(filepath.Join(mountPoint, path)); err == nil {
+			resolved = filepath.Join(mountPoint, path)
+			break
+		}
+	}
+
+	fileRequest := request.Clone(request.Context())
+	fileRequest.URL = &url.URL{Scheme: FileMirrorScheme, Path: filepath.ToSlash(resolved)}
+
+	return fileTransport.RoundTrip(fileRequest)
+}
+
+// removableMediaMountPoints returns the dirs removable media with the label are mounted at, or all of them if the
+// label is empty.
+func removableMediaMountPoints(label string) []string {
+	mountPoints := []string{}
+
+	matches := func(name string) bool {
+		return label == "" || strings.EqualFold(name, label)
+	}
+
+	for _, mediaDir := range RemovableMediaDirs {
+		entries, err := os.ReadDir(mediaDir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+
+			if matches(entry.Name()) {
+				mountPoints = append(mountPoints, filepath.Join(mediaDir, entry.Name()))
+			}
+
+			// e.g. /media/<user>/<label>
+			userEntries, err := os.ReadDir(filepath.Join(mediaDir, entry.Name()))
+			if err != nil {
+				continue
+			}
+			for _, userEntry := range userEntries {
+				if userEntry.IsDir() && matches(userEntry.Name()) {
+					mountPoints = append(mountPoints, filepath.Join(mediaDir, entry.Name(), userEntry.Name()))
+				}
+			}
+		}
+	}
+
+	return mountPoints
+}
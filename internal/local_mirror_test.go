@@ -0,0 +1,107 @@
+package internal_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsLocalMirror(t *testing.T) {
+	assert.True(t, internal.IsLocalMirror("file:///mnt/share/zimaos/"))
+	assert.True(t, internal.IsLocalMirror("usb://ZIMAOS/zimaos/"))
+	assert.True(t, internal.IsLocalMirror("usb:///zimaos/"))
+	assert.False(t, internal.IsLocalMirror("https://casaos.oss-cn-shanghai.aliyuncs.com/IceWhaleTech/zimaos-rauc/"))
+}
+
+func TestDownloadFromLocalMirror(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	share := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(share, "zimaos.raucb"), []byte("package"), 0o600))
+
+	outDir := t.TempDir()
+
+	t.Cleanup(func() { internal.ConfigureRetry(config.RetryInfo) })
+	internal.ConfigureRetry(&config.RetryModel{Attempts: 1})
+
+	mirrors := config.ServerInfo.Mirrors
+	defer func() { config.ServerInfo.Mirrors = mirrors }()
+
+	config.ServerInfo.Mirrors = []string{"file://" + share + "/", "usb://ZIMAOS/zimaos/", "usb:///zimaos/"}
+
+	// a share
+	filePath, err := internal.Download(context.Background(), outDir, "file://"+share+"/zimaos.raucb")
+	assert.NoError(t, err)
+	buf, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "package", string(buf))
+
+	_, err = internal.Download(context.Background(), outDir, "file://"+share+"/missing.raucb")
+	assert.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(outDir, "missing.raucb"))
+
+	// only the configured mirrors are served, even by a path which leaves the share
+	_, err = internal.Download(context.Background(), outDir, "file:///etc/hostname")
+	assert.ErrorIs(t, err, internal.ErrLocalMirrorNotConfigured)
+
+	_, err = internal.Download(context.Background(), outDir, "file://"+share+"/../hostname")
+	assert.ErrorIs(t, err, internal.ErrLocalMirrorNotConfigured)
+
+	// a stick mounted for a user
+	mediaDirs := internal.RemovableMediaDirs
+	defer func() { internal.RemovableMediaDirs = mediaDirs }()
+
+	media := t.TempDir()
+	internal.RemovableMediaDirs = []string{media}
+
+	stick := filepath.Join(media, "casaos", "ZIMAOS", "zimaos")
+	assert.NoError(t, os.MkdirAll(stick, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(stick, "zimaos.raucb"), []byte("package on stick"), 0o600))
+
+	for _, url := range []string{"usb://ZIMAOS/zimaos/zimaos.raucb", "usb://zimaos/zimaos/zimaos.raucb", "usb:///zimaos/zimaos.raucb"} {
+		filePath := filepath.Join(t.TempDir(), "zimaos.raucb")
+		assert.NoError(t, internal.DownloadAs(context.Background(), filePath, url), url)
+
+		buf, err := os.ReadFile(filePath)
+		assert.NoError(t, err)
+		assert.Equal(t, "package on stick", string(buf))
+	}
+
+	// no stick with the label
+	assert.Error(t, internal.DownloadAs(context.Background(), filepath.Join(t.TempDir(), "zimaos.raucb"), "usb://OTHER/zimaos/zimaos.raucb"))
+}
+
+func TestRedirectToLocalFile(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	share := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(share, "zimaos.raucb"), []byte("package"), 0o600))
+
+	t.Cleanup(func() { internal.ConfigureRetry(config.RetryInfo) })
+	internal.ConfigureRetry(&config.RetryModel{Attempts: 1})
+
+	mirrors := config.ServerInfo.Mirrors
+	defer func() { config.ServerInfo.Mirrors = mirrors }()
+
+	// even a configured local mirror is not a place to redirect to
+	config.ServerInfo.Mirrors = []string{"file://" + share + "/"}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "file://"+share+"/zimaos.raucb", http.StatusFound)
+	}))
+	defer server.Close()
+
+	err := internal.DownloadAs(context.Background(), filepath.Join(t.TempDir(), "zimaos.raucb"), server.URL+"/zimaos.raucb")
+	assert.ErrorIs(t, err, internal.ErrUnsafeRedirect)
+
+	_, err = internal.NewHTTPClient(0).Get(server.URL + "/zimaos.raucb")
+	assert.ErrorIs(t, err, internal.ErrUnsafeRedirect)
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/samber/lo"
+)
+
+// normalizeLocale turns `zh_CN`, `ZH-cn` and the like into `zh-cn` for comparison.
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+func baseLanguage(locale string) string {
+	language, _, _ := strings.Cut(normalizeLocale(locale), "-")
+	return language
+}
+
+// ParseAcceptLanguage returns the locales in an Accept-Language header, from the most preferred to the least.
+// `*` and locales with q=0 are dropped.
+func ParseAcceptLanguage(header string) []string {
+	type preference struct {
+		locale string
+		q      float64
+	}
+
+	preferences := []preference{}
+	for _, part := range strings.Split(header, ",") {
+		locale, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		locale = strings.TrimSpace(locale)
+		if locale == "" || locale == "*" {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		if q <= 0 {
+			continue
+		}
+
+		preferences = append(preferences, preference{locale: locale, q: q})
+	}
+
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].q > preferences[j].q
+	})
+
+	return lo.Map(preferences, func(p preference, _ int) string { return p.locale })
+}
+
+// LocalizedReleaseNotes returns the release notes for the first of the preferred locales the release has notes for.
+// `zh-CN` matches `zh-CN`, then any `zh` notes. the default release notes are returned if nothing matches.
+func LocalizedReleaseNotes(release codegen.Release, preferences []string) string {
+	if release.LocalizedReleaseNotes == nil || len(*release.LocalizedReleaseNotes) == 0 {
+		return release.ReleaseNotes
+	}
+
+	// sorted for a stable choice among locales of the same language
+	locales := lo.Filter(lo.Keys(*release.LocalizedReleaseNotes), func(locale string, _ int) bool {
+		return strings.TrimSpace((*release.LocalizedReleaseNotes)[locale]) != ""
+	})
+	sort.Strings(locales)
+
+	for _, preference := range preferences {
+		if locale, ok := lo.Find(locales, func(locale string) bool {
+			return normalizeLocale(locale) == normalizeLocale(preference)
+		}); ok {
+			return (*release.LocalizedReleaseNotes)[locale]
+		}
+
+		if locale, ok := lo.Find(locales, func(locale string) bool {
+			return baseLanguage(locale) == baseLanguage(preference)
+		}); ok {
+			return (*release.LocalizedReleaseNotes)[locale]
+		}
+	}
+
+	return release.ReleaseNotes
+}
@@ -0,0 +1,44 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	assert.Equal(t, []string{"zh-CN", "zh", "en"}, internal.ParseAcceptLanguage("zh-CN,zh;q=0.9,en;q=0.8"))
+	assert.Equal(t, []string{"en-US", "zh-TW"}, internal.ParseAcceptLanguage("zh-TW;q=0.5, *;q=0.1, en-US, fr;q=0"))
+	assert.Empty(t, internal.ParseAcceptLanguage(""))
+}
+
+func TestLocalizedReleaseNotes(t *testing.T) {
+	release := codegen.Release{
+		ReleaseNotes: "default",
+		LocalizedReleaseNotes: &map[string]string{
+			"zh-CN": "简体中文",
+			"zh-TW": "繁體中文",
+			"en":    "english",
+			"fr":    "  ",
+		},
+	}
+
+	assert.Equal(t, "简体中文", internal.LocalizedReleaseNotes(release, []string{"zh_cn"}))
+	assert.Equal(t, "繁體中文", internal.LocalizedReleaseNotes(release, []string{"zh-TW", "zh-CN"}))
+
+	// same language of another region
+	assert.Equal(t, "english", internal.LocalizedReleaseNotes(release, []string{"en-GB"}))
+	assert.Equal(t, "简体中文", internal.LocalizedReleaseNotes(release, []string{"zh"}))
+
+	// the first preference with notes wins
+	assert.Equal(t, "english", internal.LocalizedReleaseNotes(release, []string{"de", "en"}))
+
+	// empty notes are skipped
+	assert.Equal(t, "default", internal.LocalizedReleaseNotes(release, []string{"fr"}))
+
+	assert.Equal(t, "default", internal.LocalizedReleaseNotes(release, []string{"ja"}))
+	assert.Equal(t, "default", internal.LocalizedReleaseNotes(release, nil))
+	assert.Equal(t, "default", internal.LocalizedReleaseNotes(codegen.Release{ReleaseNotes: "default"}, []string{"en"}))
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"go.uber.org/zap"
+)
+
+type fetchResultKey struct{}
+
+// FetchResult tells how a release manifest was fetched, see WithFetchResult
+type FetchResult struct {
+	URL string
+
+	// the mirror answered 304 and the manifest cached on disk is used
+	NotModified bool
+}
+
+// WithFetchResult returns a context which collects the result of the last successful manifest fetch into the returned FetchResult.
+func WithFetchResult(ctx context.Context) (context.Context, *FetchResult) {
+	result := &FetchResult{}
+	return context.WithValue(ctx, fetchResultKey{}, result), result
+}
+
+func reportFetchResult(ctx context.Context, url string, notModified bool) {
+	if result, ok := ctx.Value(fetchResultKey{}).(*FetchResult); ok {
+		result.URL = url
+		result.NotModified = notModified
+	}
+}
+
+// the validators of a cached manifest, the content and the signature are kept next to it.
+type cachedManifest struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	SHA256       string    `json:"sha256"`
+	FetchedAt    time.Time `json:"fetched_at"`
+
+	content   []byte
+	signature []byte
+}
+
+func ManifestCacheDir() string {
+	return filepath.Join(config.ServerInfo.CachePath, "manifests")
+}
+
+func manifestCachePath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(ManifestCacheDir(), hex.EncodeToString(sum[:]))
+}
+
+// loadCachedManifest returns nil if the manifest of url is not cached, or the cache is broken.
+func loadCachedManifest(url string) *cachedManifest {
+	path := manifestCachePath(url)
+
+	buf, err := os.ReadFile(path + ".json")
+	if err != nil {
+		return nil
+	}
+
+	var cached cachedManifest
+	if err := json.Unmarshal(buf, &cached); err != nil || cached.URL != url {
+		return nil
+	}
+
+	if cached.content, err = os.ReadFile(path + ".yaml"); err != nil {
+		return nil
+	}
+
+	// the content is written before the validators, a mismatch means a write was interrupted
+	if sum := sha256.Sum256(cached.content); hex.EncodeToString(sum[:]) != cached.SHA256 {
+		logger.Info("cached manifest does not match its checksum - ignoring", zap.String("url", url))
+		return nil
+	}
+
+	if signature, err := os.ReadFile(path + ReleaseSignatureSuffix); err == nil {
+		cached.signature = signature
+	}
+
+	return &cached
+}
+
+func saveCachedManifest(cached *cachedManifest) {
+	path := manifestCachePath(cached.URL)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		logger.Error("error when trying to create manifest cache dir", zap.Error(err))
+		return
+	}
+
+	sum := sha256.Sum256(cached.content)
+	cached.SHA256 = hex.EncodeToString(sum[:])
+
+	if err := os.WriteFile(path+".yaml", cached.content, 0o600); err != nil {
+		logger.Error("error when trying to cache manifest", zap.Error(err), zap.String("url", cached.URL))
+		return
+	}
+
+	if cached.signature == nil {
+		os.Remove(path + ReleaseSignatureSuffix)
+	} else if err := os.WriteFile(path+ReleaseSignatureSuffix, cached.signature, 0o600); err != nil {
+		logger.Error("error when trying to cache manifest signature", zap.Error(err), zap.String("url", cached.URL))
+		return
+	}
+
+	buf, err := json.MarshalIndent(cached, "", "  ")
+	if err != nil {
+		logger.Error("error when trying to marshal manifest validators", zap.Error(err))
+		return
+	}
+
+	if err := os.WriteFile(path+".json", buf, 0o600); err != nil {
+		logger.Error("error when trying to cache manifest validators", zap.Error(err), zap.String("url", cached.URL))
+	}
+}
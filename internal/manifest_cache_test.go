@@ -0,0 +1,80 @@
+package internal_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/common"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetReleaseFromNotModified(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	config.ServerInfo.CachePath = t.TempDir()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	defer func(keyring []string) { config.SecurityInfo.Keyring = keyring }(config.SecurityInfo.Keyring)
+	config.SecurityInfo.Keyring = []string{base64.StdEncoding.EncodeToString(publicKey)}
+
+	content := []byte(common.SampleReleaseYAML)
+	modTime := time.Now().Add(-time.Hour)
+
+	var manifestDownloads, signatureDownloads atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, internal.ReleaseSignatureSuffix) {
+			signatureDownloads.Add(1)
+			w.Write([]byte(base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, content))))
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") != `"v1"` {
+			manifestDownloads.Add(1)
+		}
+		http.ServeContent(w, r, "release.yaml", modTime, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	releaseURL := server.URL + "/casaos-release"
+
+	ctx, result := internal.WithFetchResult(context.Background())
+	release, err := internal.GetReleaseFrom(ctx, releaseURL)
+	assert.NoError(t, err)
+	assert.NotNil(t, release)
+	assert.False(t, result.NotModified)
+	assert.Equal(t, releaseURL, result.URL)
+
+	// the manifest and its signature are served from the cache
+	ctx, result = internal.WithFetchResult(context.Background())
+	cachedRelease, err := internal.GetReleaseFrom(ctx, releaseURL)
+	assert.NoError(t, err)
+	assert.True(t, result.NotModified)
+	assert.Equal(t, release, cachedRelease)
+
+	assert.EqualValues(t, 1, manifestDownloads.Load())
+	assert.EqualValues(t, 1, signatureDownloads.Load())
+
+	// the cached manifest is verified again with the current keyring
+	otherPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	config.SecurityInfo.Keyring = []string{base64.StdEncoding.EncodeToString(otherPublicKey)}
+
+	_, err = internal.GetReleaseFrom(context.Background(), releaseURL)
+	assert.ErrorIs(t, err, internal.ErrReleaseSignatureInvalid)
+}
@@ -0,0 +1,310 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"go.uber.org/zap"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// PeerServiceType is the DNS-SD service installers advertise their cached releases with on the LAN.
+const PeerServiceType = "_casaos-installer._tcp.local."
+
+const (
+	mdnsRecordTTL = 120
+
+	// the TXT key of the versions shared, separated by comma
+	peerVersionsKey = "versions="
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// Peer is an installer on the LAN which shares its cached releases.
+type Peer struct {
+	Instance string
+
+	// host:port of the peer share, the host is where the answer came from
+	Addr string
+
+	Versions []string
+}
+
+// PeerAdvertisement is what is answered to the queries for PeerServiceType.
+type PeerAdvertisement struct {
+	Instance string
+	Port     int
+
+	// the versions shared at the time of the query
+	Versions func() []string
+}
+
+// AdvertisePeer answers the mDNS queries for PeerServiceType until ctx is done. the answer goes to the querier
+// directly, so that a browser does not have to join the multicast group.
+func AdvertisePeer(ctx context.Context, ad PeerAdvertisement) error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		response, ok := peerAnswer(buf[:n], ad)
+		if !ok {
+			continue
+		}
+
+		if _, err := conn.WriteToUDP(response, from); err != nil {
+			logger.Error("error when trying to answer mDNS query", zap.Error(err), zap.String("to", from.String()))
+		}
+	}
+}
+
+// BrowsePeers asks for PeerServiceType on the LAN, and returns the peers answered within the timeout.
+func BrowsePeers(ctx context.Context, timeout time.Duration) ([]Peer, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	query, err := peerQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.WriteToUDP(query, mdnsGroup); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	peers := []Peer{}
+	seen := map[string]bool{}
+
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return peers, nil
+			}
+			return peers, err
+		}
+
+		peer, ok := parsePeerAnswer(buf[:n], from.IP)
+		if !ok || seen[peer.Instance] {
+			continue
+		}
+
+		seen[peer.Instance] = true
+		peers = append(peers, peer)
+	}
+}
+
+func peerQuery() ([]byte, error) {
+	name, err := dnsmessage.NewName(PeerServiceType)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+
+	if err := builder.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+
+	return builder.Finish()
+}
+
+// peerAnswer returns the answer to the query, or false if it does not ask for PeerServiceType.
+func peerAnswer(query []byte, ad PeerAdvertisement) ([]byte, bool) {
+	var parser dnsmessage.Parser
+
+	header, err := parser.Start(query)
+	if err != nil || header.Response {
+		return nil, false
+	}
+
+	questions, err := parser.AllQuestions()
+	if err != nil {
+		return nil, false
+	}
+
+	for _, question := range questions {
+		// the top bit of the class is the unicast response bit in mDNS
+		if !strings.EqualFold(question.Name.String(), PeerServiceType) || question.Class&0x7fff != dnsmessage.ClassINET {
+			continue
+		}
+		if question.Type != dnsmessage.TypePTR && question.Type != dnsmessage.TypeALL {
+			continue
+		}
+
+		answer, err := buildPeerAnswer(header.ID, question, ad)
+		if err != nil {
+			logger.Error("error when trying to build mDNS answer", zap.Error(err))
+			return nil, false
+		}
+		return answer, true
+	}
+
+	return nil, false
+}
+
+func buildPeerAnswer(id uint16, question dnsmessage.Question, ad PeerAdvertisement) ([]byte, error) {
+	serviceName, err := dnsmessage.NewName(PeerServiceType)
+	if err != nil {
+		return nil, err
+	}
+
+	instanceName, err := dnsmessage.NewName(ad.Instance + "." + PeerServiceType)
+	if err != nil {
+		return nil, err
+	}
+
+	targetName, err := dnsmessage.NewName(ad.Instance + ".local.")
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []string{}
+	if ad.Versions != nil {
+		versions = ad.Versions()
+	}
+
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, Response: true, Authoritative: true})
+	builder.EnableCompression()
+
+	// a querier from another port than 5353 expects the question back, see RFC 6762 section 6.7
+	question.Class &= 0x7fff
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(question); err != nil {
+		return nil, err
+	}
+
+	if err := builder.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	resourceHeader := func(name dnsmessage.Name) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: mdnsRecordTTL}
+	}
+
+	if err := builder.PTRResource(resourceHeader(serviceName), dnsmessage.PTRResource{PTR: instanceName}); err != nil {
+		return nil, err
+	}
+
+	if err := builder.SRVResource(resourceHeader(instanceName), dnsmessage.SRVResource{Port: uint16(ad.Port), Target: targetName}); err != nil {
+		return nil, err
+	}
+
+	// a TXT string is at most 255 bytes, the versions are cut there
+	txt := peerVersionsKey + strings.Join(versions, ",")
+	if len(txt) > 255 {
+		// a first version which is too long alone is left out rather than cut
+		if index := strings.LastIndex(txt[:256], ","); index >= 0 {
+			txt = txt[:index]
+		} else {
+			txt = peerVersionsKey
+		}
+	}
+	if err := builder.TXTResource(resourceHeader(instanceName), dnsmessage.TXTResource{TXT: []string{txt}}); err != nil {
+		return nil, err
+	}
+
+	return builder.Finish()
+}
+
+// parsePeerAnswer returns the peer in the answer from the host, or false if it is not about PeerServiceType.
+func parsePeerAnswer(answer []byte, host net.IP) (Peer, bool) {
+	var parser dnsmessage.Parser
+
+	header, err := parser.Start(answer)
+	if err != nil || !header.Response {
+		return Peer{}, false
+	}
+
+	if err := parser.SkipAllQuestions(); err != nil {
+		return Peer{}, false
+	}
+
+	resources, err := parser.AllAnswers()
+	if err != nil {
+		return Peer{}, false
+	}
+
+	var peer Peer
+	port := 0
+
+	for _, resource := range resources {
+		switch body := resource.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if strings.EqualFold(resource.Header.Name.String(), PeerServiceType) {
+				peer.Instance = strings.TrimSuffix(body.PTR.String(), "."+PeerServiceType)
+			}
+		case *dnsmessage.SRVResource:
+			port = int(body.Port)
+		case *dnsmessage.TXTResource:
+			for _, txt := range body.TXT {
+				if versions, ok := strings.CutPrefix(txt, peerVersionsKey); ok && versions != "" {
+					peer.Versions = strings.Split(versions, ",")
+				}
+			}
+		}
+	}
+
+	if peer.Instance == "" || port == 0 {
+		return Peer{}, false
+	}
+
+	peer.Addr = net.JoinHostPort(host.String(), strconv.Itoa(port))
+	return peer, true
+}
+
+// PeerInstanceName returns the instance name to advertise for the share on port.
+func PeerInstanceName(port int) string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "casaos"
+	}
+
+	// a label is at most 63 bytes, and a dot would make another one
+	hostname = strings.ReplaceAll(hostname, ".", "-")
+	name := fmt.Sprintf("%s-%d", hostname, port)
+	if len(name) > 63 {
+		name = name[len(name)-63:]
+	}
+	return name
+}
@@ -0,0 +1,66 @@
+package internal_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+// browseAdvertisedPeer advertises ad and returns it as browsed, the test is skipped if multicast is not available
+func browseAdvertisedPeer(t *testing.T, ad internal.PeerAdvertisement) internal.Peer {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	advertised := make(chan error, 1)
+	go func() {
+		advertised <- internal.AdvertisePeer(ctx, ad)
+	}()
+
+	// wait for the multicast group to be joined
+	select {
+	case err := <-advertised:
+		t.Skipf("multicast is not available: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	peers, err := internal.BrowsePeers(ctx, time.Second)
+	if err != nil {
+		t.Skipf("multicast is not available: %v", err)
+	}
+
+	for _, peer := range peers {
+		if peer.Instance == ad.Instance {
+			return peer
+		}
+	}
+
+	t.Skip("multicast is not looped back")
+	return internal.Peer{}
+}
+
+func TestBrowsePeers(t *testing.T) {
+	found := browseAdvertisedPeer(t, internal.PeerAdvertisement{
+		Instance: "test-8339",
+		Port:     8339,
+		Versions: func() []string { return []string{"v1.0.0", "v1.1.0"} },
+	})
+
+	assert.Equal(t, []string{"v1.0.0", "v1.1.0"}, found.Versions)
+	assert.Contains(t, found.Addr, ":8339")
+}
+
+func TestBrowsePeersTooLongVersion(t *testing.T) {
+	// the versions do not fit in a TXT string, not even the first one
+	found := browseAdvertisedPeer(t, internal.PeerAdvertisement{
+		Instance: "test-8340",
+		Port:     8340,
+		Versions: func() []string { return []string{"v1.0.0-" + strings.Repeat("a", 300), "v1.1.0"} },
+	})
+
+	assert.Empty(t, found.Versions)
+	assert.Contains(t, found.Addr, ":8340")
+}
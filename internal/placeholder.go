@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/common"
+	"github.com/samber/lo"
+)
+
+var placeholderPattern = regexp.MustCompile(`\$\{[A-Za-z_]+\}`)
+
+var KnownPlaceholders = []string{
+	common.MirrorPlaceHolder,
+	common.ArchPlaceHolder,
+	common.VersionPlaceHolder,
+	common.ModelPlaceHolder,
+}
+
+// ExpandPlaceholders replaces the placeholders in s with the values for the mirror, the release and this device.
+// unknown placeholders are left as is.
+func ExpandPlaceholders(s string, release codegen.Release, mirror string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+
+	return strings.NewReplacer(
+		common.MirrorPlaceHolder, strings.TrimSuffix(mirror, "/"),
+		common.ArchPlaceHolder, CurrentArchitecture(),
+		common.VersionPlaceHolder, release.Version,
+		common.ModelPlaceHolder, DeviceModel(),
+	).Replace(s)
+}
+
+// UnknownPlaceholders returns the placeholders in s which ExpandPlaceholders does not know about.
+func UnknownPlaceholders(s string) []string {
+	unknown := []string{}
+	for _, placeholder := range placeholderPattern.FindAllString(s, -1) {
+		if !lo.Contains(KnownPlaceholders, placeholder) {
+			unknown = append(unknown, placeholder)
+		}
+	}
+	return unknown
+}
+
+// IsMirrorRelative returns true if path is to be appended to a mirror, rather than an absolute url starting with `${MIRROR}`.
+func IsMirrorRelative(path string) bool {
+	return !strings.HasPrefix(path, common.MirrorPlaceHolder)
+}
+
+// ResolveReleaseURL returns the url of path in the release on the mirror, with placeholders expanded.
+func ResolveReleaseURL(release codegen.Release, mirror, path string) string {
+	if IsMirrorRelative(path) {
+		path = strings.TrimSuffix(mirror, "/") + path
+	}
+	return ExpandPlaceholders(path, release, mirror)
+}
+
+// ExpandReleaseLinks expands the placeholders in the background and release notes of the release with the
+// mirror it was fetched from. package paths and checksums are left as is, they are expanded for each mirror on download.
+func ExpandReleaseLinks(release *codegen.Release, mirror string) {
+	if release == nil {
+		return
+	}
+
+	release.ReleaseNotes = ExpandPlaceholders(release.ReleaseNotes, *release, mirror)
+	if release.LocalizedReleaseNotes != nil {
+		localized := map[string]string{}
+		for locale, notes := range *release.LocalizedReleaseNotes {
+			localized[locale] = ExpandPlaceholders(notes, *release, mirror)
+		}
+		release.LocalizedReleaseNotes = &localized
+	}
+	if release.Background != nil {
+		background := ExpandPlaceholders(*release.Background, *release, mirror)
+		release.Background = &background
+	}
+}
@@ -0,0 +1,72 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlaceholders(t *testing.T) {
+	release := codegen.Release{
+		Version:      "v1.2.0",
+		ReleaseNotes: "see ${MIRROR}/notes/${VERSION}.md",
+		Background:   lo.ToPtr("${MIRROR}/backgrounds/${VERSION}.png"),
+		Mirrors:      []string{"https://a.example.com/", "https://b.example.com"},
+		Packages: []codegen.Package{
+			{Architecture: codegen.Any, Path: "/get/${VERSION}/casaos-${ARCH}-${VERSION}.tar.gz"},
+		},
+		Checksums: "${MIRROR}/checksums/${VERSION}-${MODEL}.txt",
+	}
+
+	arch := internal.CurrentArchitecture()
+	model := internal.DeviceModel()
+
+	t.Run("package path is expanded per mirror", func(t *testing.T) {
+		packageURL, err := internal.GetPackageURLByCurrentArch(release, "https://a.example.com/")
+		if arch != string(codegen.Amd64) && arch != string(codegen.Arm64) && arch != string(codegen.Arm7) {
+			assert.Error(t, err)
+			return
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, "https://a.example.com/get/v1.2.0/casaos-"+arch+"-v1.2.0.tar.gz", packageURL)
+	})
+
+	t.Run("absolute url starting with mirror", func(t *testing.T) {
+		assert.Equal(t, "https://b.example.com/checksums/v1.2.0-"+model+".txt", internal.GetChecksumsURL(release, "https://b.example.com"))
+	})
+
+	t.Run("package for the exact architecture is preferred", func(t *testing.T) {
+		specific := release
+		specific.Packages = append([]codegen.Package{{Architecture: codegen.PackageArchitecture(arch), Path: "/specific.tar.gz"}}, release.Packages...)
+
+		pkg, ok := internal.SelectPackage(specific, internal.CurrentDevice())
+		assert.True(t, ok)
+		assert.Equal(t, "/specific.tar.gz", pkg.Path)
+	})
+
+	t.Run("links are expanded with the mirror the release came from", func(t *testing.T) {
+		expanded := release
+		internal.ExpandReleaseLinks(&expanded, "https://a.example.com/")
+		assert.Equal(t, "see https://a.example.com/notes/v1.2.0.md", expanded.ReleaseNotes)
+		assert.Equal(t, "https://a.example.com/backgrounds/v1.2.0.png", *expanded.Background)
+
+		// the original is untouched
+		assert.Equal(t, "${MIRROR}/backgrounds/${VERSION}.png", *release.Background)
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		problems := internal.ValidateRelease(release)
+		assert.False(t, internal.HasReleaseError(problems), problems)
+
+		invalid := release
+		invalid.Checksums = "checksums/${CHANNEL}.txt"
+		problems = internal.ValidateRelease(invalid)
+		assert.True(t, internal.HasReleaseError(problems))
+		assert.True(t, lo.ContainsBy(problems, func(problem codegen.ReleaseProblem) bool {
+			return problem.Severity == codegen.Warning && problem.Field == "checksums"
+		}))
+	})
+}
@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReleaseIndex lists the releases published in a channel, see service.HyperFileTagReleaseIndexURL
+type ReleaseIndex struct {
+	Releases []ReleaseIndexEntry `yaml:"releases"`
+}
+
+type ReleaseIndexEntry struct {
+	Version      string `yaml:"version"`
+	ReleaseNotes string `yaml:"release_notes,omitempty"`
+	Important    bool   `yaml:"important,omitempty"`
+
+	// path of the release manifest, relative to the mirror
+	Path string `yaml:"path"`
+
+	// architectures the release has packages for. all architectures if empty
+	Architectures []string `yaml:"architectures,omitempty"`
+}
+
+func GetReleaseIndexFrom(ctx context.Context, indexURL string) (*ReleaseIndex, error) {
+	response, err := client.R().SetContext(ctx).Get(indexURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to get release index from %s - %s", indexURL, response.Status())
+	}
+
+	// the index decides where release manifests come from, so it is signed the same way as them.
+	if _, err := verifyReleaseSignatureFrom(ctx, indexURL, response.Body(), nil); err != nil {
+		return nil, err
+	}
+
+	var index ReleaseIndex
+	if err := yaml.Unmarshal(response.Body(), &index); err != nil {
+		return nil, err
+	}
+
+	return &index, nil
+}
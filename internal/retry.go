@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+)
+
+// retryPolicy is shared by manifest fetches, probes and downloads, see ConfigureRetry
+var retryPolicy = *config.RetryInfo
+
+// ConfigureRetry applies the retry policy to all outbound requests. it should be called before any request is made.
+func ConfigureRetry(retry *config.RetryModel) {
+	policy := *retry
+	if policy.Attempts < 1 {
+		policy.Attempts = 1
+	}
+	if policy.MaxWaitTime < policy.WaitTime {
+		policy.MaxWaitTime = policy.WaitTime
+	}
+
+	retryPolicy = policy
+
+	client.
+		SetRetryCount(policy.Attempts - 1).
+		SetRetryWaitTime(policy.WaitTime).
+		SetRetryMaxWaitTime(policy.MaxWaitTime)
+}
+
+// RetryPolicy returns the retry policy in effect.
+func RetryPolicy() config.RetryModel {
+	return retryPolicy
+}
+
+// RetryBackoff returns the wait after the attempt, starting from 1. it is doubled for each attempt up to the max.
+func RetryBackoff(attempt int) time.Duration {
+	wait := retryPolicy.WaitTime
+	for i := 1; i < attempt && wait < retryPolicy.MaxWaitTime; i++ {
+		wait *= 2
+	}
+	return min(wait, retryPolicy.MaxWaitTime)
+}
+
+// Probe sends a HEAD request to url within the probe timeout. it is retried by the policy if it fails to connect or
+// the server fails, but not if the server answers that it does not have the file.
+func Probe(ctx context.Context, url string) (*http.Response, error) {
+	client := NewHTTPClient(retryPolicy.ProbeTimeout)
+
+	for attempt := 1; ; attempt++ {
+		request, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := client.Do(request)
+		if err == nil {
+			response.Body.Close()
+			if response.StatusCode < http.StatusInternalServerError {
+				return response, nil
+			}
+		}
+
+		if attempt >= retryPolicy.Attempts || ctx.Err() != nil {
+			return response, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(RetryBackoff(attempt)):
+		}
+	}
+}
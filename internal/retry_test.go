@@ -0,0 +1,65 @@
+package internal_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	t.Cleanup(func() { internal.ConfigureRetry(config.RetryInfo) })
+
+	internal.ConfigureRetry(&config.RetryModel{Attempts: 5, WaitTime: time.Second, MaxWaitTime: 5 * time.Second})
+
+	assert.Equal(t, time.Second, internal.RetryBackoff(1))
+	assert.Equal(t, 2*time.Second, internal.RetryBackoff(2))
+	assert.Equal(t, 4*time.Second, internal.RetryBackoff(3))
+	assert.Equal(t, 5*time.Second, internal.RetryBackoff(4))
+	assert.Equal(t, 5*time.Second, internal.RetryBackoff(10))
+
+	// at least one attempt is made
+	internal.ConfigureRetry(&config.RetryModel{})
+	assert.Equal(t, 1, internal.RetryPolicy().Attempts)
+}
+
+func TestProbe(t *testing.T) {
+	t.Cleanup(func() { internal.ConfigureRetry(config.RetryInfo) })
+
+	internal.ConfigureRetry(&config.RetryModel{Attempts: 3, WaitTime: 10 * time.Millisecond, MaxWaitTime: 10 * time.Millisecond, ProbeTimeout: time.Second})
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			// fails until the last attempt
+			if requests.Add(1) < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			requests.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	response, err := internal.Probe(context.Background(), server.URL+"/flaky")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.EqualValues(t, 3, requests.Load())
+
+	// not found is an answer, so it is not retried
+	requests.Store(0)
+	response, err = internal.Probe(context.Background(), server.URL+"/missing")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	assert.EqualValues(t, 1, requests.Load())
+}
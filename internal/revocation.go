@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrRevocationListNotFound = fmt.Errorf("revocation list not found")
+
+// RevocationList lists the releases pulled from a channel, see service.HyperFileTagRevocationListURL
+type RevocationList struct {
+	Revoked []RevokedRelease `yaml:"revoked"`
+}
+
+type RevokedRelease struct {
+	Version string `yaml:"version"`
+	Reason  string `yaml:"reason,omitempty"`
+}
+
+func GetRevocationListFrom(ctx context.Context, listURL string) (*RevocationList, error) {
+	response, err := client.R().SetContext(ctx).Get(listURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode() == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrRevocationListNotFound, listURL)
+	}
+
+	if response.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to get revocation list from %s - %s", listURL, response.Status())
+	}
+
+	// anyone who can serve the list could otherwise revoke any release, so it is signed the same way as release manifests.
+	if _, err := verifyReleaseSignatureFrom(ctx, listURL, response.Body(), nil); err != nil {
+		return nil, err
+	}
+
+	var list RevocationList
+	if err := yaml.Unmarshal(response.Body(), &list); err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+func GetRevocationListFromLocal(listPath string) (*RevocationList, error) {
+	buf, err := os.ReadFile(listPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var list RevocationList
+	if err := yaml.Unmarshal(buf, &list); err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+func WriteRevocationListToLocal(list *RevocationList, listPath string) error {
+	buf, err := yaml.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(listPath), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(listPath, buf, 0o600)
+}
@@ -0,0 +1,321 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	DownloadSegmentSize = 8 * 1024 * 1024
+
+	// a source slower than this fraction of the fastest one is not used any more
+	slowSourceRatio = 0.25
+
+	// a source which fails this many segments is not used any more
+	maxSourceFailures = 2
+)
+
+var ErrNoDownloadSource = fmt.Errorf("no download source left")
+
+// SourceStat is how a source did in a segmented download
+type SourceStat struct {
+	URL        string
+	Downloaded int64
+	Elapsed    time.Duration
+	Failures   int
+
+	// the last error of the source, if any
+	Err error
+
+	// the source is not used any more, because it is slow or failing
+	Retired bool
+}
+
+func (s SourceStat) speed() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Downloaded) / s.Elapsed.Seconds()
+}
+
+type segmentedDownload struct {
+	ctx      context.Context
+	file     *os.File
+	partPath string
+	size     int64
+	limiter  *DownloadLimiter
+	progress func(downloaded, totalSize int64)
+
+	downloaded atomic.Int64
+
+	lock      sync.Mutex
+	metadata  partialDownload
+	stats     []SourceStat
+	active    int
+	remaining int
+	queue     chan int
+	done      chan struct{}
+}
+
+// DownloadSegmented downloads the same file of size from all urls at once. the file is split into segments of
+// DownloadSegmentSize, which are taken by whichever source is free, so faster sources download more of them.
+// a source is retired when it keeps failing, or it is much slower than the fastest one. done segments are kept in
+// `<filePath>.part` to be resumed, and the file is moved into place only after all verifiers pass.
+func DownloadSegmented(ctx context.Context, filePath string, urls []string, size int64, verifiers ...DownloadVerifier) ([]SourceStat, error) {
+	if len(urls) == 0 || size <= 0 {
+		return nil, fmt.Errorf("segmented download needs sources and the size")
+	}
+
+	logger.Info("Downloading package in segments", zap.Strings("urls", urls), zap.String("filepath", filePath), zap.Int64("size", size))
+
+	partPath := filePath + PartialDownloadSuffix
+	segments := int((size + DownloadSegmentSize - 1) / DownloadSegmentSize)
+
+	// a partial download of a single source cannot be resumed in segments, and vice versa
+	metadata, err := readPartialDownload(partPath)
+	if err != nil || metadata.URL != "" || metadata.Size != size || len(metadata.Segments) != segments {
+		metadata = partialDownload{Size: size, Segments: make([]bool, segments)}
+		os.Remove(partPath)
+	}
+
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if err := file.Truncate(size); err != nil {
+		return nil, err
+	}
+
+	d := &segmentedDownload{
+		ctx:      ctx,
+		file:     file,
+		partPath: partPath,
+		size:     size,
+		limiter:  downloadLimiterFrom(ctx),
+		progress: downloadProgressCallback(ctx),
+		metadata: metadata,
+		active:   len(urls),
+		queue:    make(chan int, segments),
+		done:     make(chan struct{}),
+	}
+
+	for segment, done := range metadata.Segments {
+		if done {
+			d.downloaded.Add(d.segmentSize(segment))
+			continue
+		}
+		d.remaining++
+		d.queue <- segment
+	}
+
+	if d.remaining == 0 {
+		close(d.done)
+	}
+
+	if err := writePartialDownload(partPath, metadata); err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	for _, url := range urls {
+		d.stats = append(d.stats, SourceStat{URL: url})
+	}
+	for i := range urls {
+		wg.Add(1)
+		go func(source int) {
+			defer wg.Done()
+			d.work(source)
+		}(i)
+	}
+	wg.Wait()
+
+	stats := append([]SourceStat{}, d.stats...)
+
+	if d.remaining > 0 {
+		if ctx.Err() != nil {
+			return stats, ctx.Err()
+		}
+		return stats, fmt.Errorf("%w: %d of %d segments are not downloaded", ErrNoDownloadSource, d.remaining, segments)
+	}
+
+	file.Close()
+
+	for _, verify := range verifiers {
+		if err := verify(partPath); err != nil {
+			removePartialDownload(partPath)
+			return stats, err
+		}
+	}
+
+	if err := os.Rename(partPath, filePath); err != nil {
+		return stats, err
+	}
+
+	os.Remove(partialDownloadMetadataPath(partPath))
+	return stats, nil
+}
+
+func (d *segmentedDownload) segmentSize(segment int) int64 {
+	start := int64(segment) * DownloadSegmentSize
+	return min(start+DownloadSegmentSize, d.size) - start
+}
+
+// work downloads segments from the source, until all segments are done or the source is retired.
+func (d *segmentedDownload) work(source int) {
+	for {
+		var segment int
+		select {
+		case <-d.done:
+			return
+		case <-d.ctx.Done():
+			return
+		case segment = <-d.queue:
+		}
+
+		start := time.Now()
+		err := d.fetch(d.stats[source].URL, segment)
+		elapsed := time.Since(start)
+
+		// to be resumed in the next window, which is not a failure of the source
+		if errors.Is(err, errOutsideDownloadWindow) {
+			d.queue <- segment
+			if err := d.limiter.waitForWindow(d.ctx); err != nil {
+				return
+			}
+			continue
+		}
+
+		if !d.report(source, segment, elapsed, err) {
+			return
+		}
+	}
+}
+
+// report returns false if the source is retired.
+func (d *segmentedDownload) report(source int, segment int, elapsed time.Duration, err error) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	stat := &d.stats[source]
+
+	if err != nil {
+		logger.Info("error while downloading segment - leaving it to other sources", zap.Error(err), zap.String("url", stat.URL), zap.Int("segment", segment))
+		stat.Failures++
+		stat.Err = err
+		d.queue <- segment
+
+		if stat.Failures >= maxSourceFailures || d.ctx.Err() != nil {
+			return d.retire(source)
+		}
+		return true
+	}
+
+	stat.Downloaded += d.segmentSize(segment)
+	stat.Elapsed += elapsed
+
+	d.metadata.Segments[segment] = true
+	if err := writePartialDownload(d.partPath, d.metadata); err != nil {
+		logger.Error("error when trying to keep segments done", zap.Error(err))
+	}
+
+	d.remaining--
+	if d.remaining == 0 {
+		close(d.done)
+		return false
+	}
+
+	// rebalance away from the source if a much faster one is there
+	for i, other := range d.stats {
+		if i != source && !other.Retired && stat.speed() < other.speed()*slowSourceRatio {
+			logger.Info("source is much slower than another one - leaving it", zap.String("url", stat.URL), zap.Float64("speed", stat.speed()), zap.String("faster_url", other.URL), zap.Float64("faster_speed", other.speed()))
+			return d.retire(source)
+		}
+	}
+
+	return true
+}
+
+// should be called with lock held
+func (d *segmentedDownload) retire(source int) bool {
+	d.stats[source].Retired = true
+	d.active--
+
+	// nobody is left to take the segments
+	if d.active == 0 && d.remaining > 0 {
+		close(d.done)
+	}
+
+	return false
+}
+
+// fetch downloads the segment from url into the part file.
+func (d *segmentedDownload) fetch(url string, segment int) error {
+	start := int64(segment) * DownloadSegmentSize
+	size := d.segmentSize(segment)
+
+	response, err := client.R().
+		SetContext(d.ctx).
+		SetDoNotParseResponse(true).
+		SetHeader("Range", fmt.Sprintf("bytes=%d-%d", start, start+size-1)).
+		Get(url)
+	if err != nil {
+		return err
+	}
+	defer response.RawBody().Close()
+
+	if response.StatusCode() != http.StatusPartialContent {
+		return fmt.Errorf("failed to download segment from %s - %s", url, response.Status())
+	}
+
+	rangeStart, total, err := parseContentRange(response.Header().Get("Content-Range"))
+	if err != nil || rangeStart != start || (total >= 0 && total != d.size) {
+		return fmt.Errorf("unexpected range `%s` from %s", response.Header().Get("Content-Range"), url)
+	}
+
+	var stream io.ReadCloser = response.RawBody()
+	if d.limiter != nil {
+		stream = &limitedReader{ctx: d.ctx, rc: stream, limiter: d.limiter}
+	}
+
+	written, err := io.Copy(io.NewOffsetWriter(d.file, start), &segmentReader{reader: io.LimitReader(stream, size), download: d})
+	if err == nil && written != size {
+		err = fmt.Errorf("segment from %s is short: expected %d, got %d", url, size, written)
+	}
+
+	if err != nil {
+		// the bytes are downloaded again by another source
+		d.downloaded.Add(-written)
+		return err
+	}
+
+	return nil
+}
+
+// segmentReader reports the progress of the whole download.
+type segmentReader struct {
+	reader   io.Reader
+	download *segmentedDownload
+}
+
+func (r *segmentReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+
+	downloaded := r.download.downloaded.Add(int64(n))
+	if r.download.progress != nil {
+		r.download.progress(downloaded, r.download.size)
+	}
+
+	return n, err
+}
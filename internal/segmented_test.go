@@ -0,0 +1,60 @@
+package internal_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadSegmented(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), (2*internal.DownloadSegmentSize+1024)/16)
+
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "zimaos.raucb", time.Time{}, bytes.NewReader(content))
+	}
+
+	mirror1 := httptest.NewServer(http.HandlerFunc(serve))
+	defer mirror1.Close()
+
+	mirror2 := httptest.NewServer(http.HandlerFunc(serve))
+	defer mirror2.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer broken.Close()
+
+	urls := []string{mirror1.URL + "/zimaos.raucb", broken.URL + "/zimaos.raucb", mirror2.URL + "/zimaos.raucb"}
+
+	filePath := filepath.Join(t.TempDir(), "zimaos.raucb")
+	stats, err := internal.DownloadSegmented(context.Background(), filePath, urls, int64(len(content)))
+	assert.NoError(t, err)
+
+	buf, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf)
+	assert.NoFileExists(t, filePath+internal.PartialDownloadSuffix)
+	assert.NoFileExists(t, filePath+internal.PartialDownloadMetadataSuffix)
+
+	assert.Len(t, stats, 3)
+	assert.NotZero(t, stats[1].Failures)
+	assert.Zero(t, stats[1].Downloaded)
+	assert.Equal(t, int64(len(content)), stats[0].Downloaded+stats[2].Downloaded)
+
+	// nothing is moved into place without a source
+	assert.NoError(t, os.Remove(filePath))
+	_, err = internal.DownloadSegmented(context.Background(), filePath, urls[1:2], int64(len(content)))
+	assert.ErrorIs(t, err, internal.ErrNoDownloadSource)
+	assert.NoFileExists(t, filePath)
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+)
+
+// ReleaseSignatureSuffix is appended to the release url to get the detached signature of the release manifest.
+const ReleaseSignatureSuffix = ".sig"
+
+var (
+	ErrReleaseUnsigned         = fmt.Errorf("release manifest is not signed")
+	ErrReleaseSignatureInvalid = fmt.Errorf("release manifest signature is invalid")
+)
+
+// IsUntrustedRelease returns true if the release manifest is rejected by signature verification.
+func IsUntrustedRelease(err error) bool {
+	return errors.Is(err, ErrReleaseUnsigned) || errors.Is(err, ErrReleaseSignatureInvalid)
+}
+
+// ParseKeyring decodes base64 encoded ed25519 public keys.
+func ParseKeyring(keys []string) ([]ed25519.PublicKey, error) {
+	keyring := []ed25519.PublicKey{}
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+
+		buf, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key in keyring `%s`: %w", key, err)
+		}
+
+		if len(buf) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid public key in keyring `%s`: expected %d bytes, got %d", key, ed25519.PublicKeySize, len(buf))
+		}
+
+		keyring = append(keyring, ed25519.PublicKey(buf))
+	}
+	return keyring, nil
+}
+
+// VerifyReleaseSignature checks the base64 encoded detached signature of content against every key in keyring.
+func VerifyReleaseSignature(content []byte, signature []byte, keyring []ed25519.PublicKey) error {
+	encoded := strings.TrimSpace(string(signature))
+	if encoded == "" {
+		return ErrReleaseUnsigned
+	}
+
+	buf, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(buf) != ed25519.SignatureSize {
+		return fmt.Errorf("%w: malformed signature", ErrReleaseSignatureInvalid)
+	}
+
+	for _, key := range keyring {
+		if ed25519.Verify(key, content, buf) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: no trusted key matches", ErrReleaseSignatureInvalid)
+}
+
+// verify the release manifest downloaded from releaseURL, and return the signature. the verification is skipped,
+// and the signature is nil, if no keyring is configured.
+//
+// the signature is not downloaded again if cachedSignature is given.
+func verifyReleaseSignatureFrom(ctx context.Context, releaseURL string, content []byte, cachedSignature []byte) ([]byte, error) {
+	keyring, err := ParseKeyring(config.SecurityInfo.Keyring)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keyring) == 0 {
+		return nil, nil
+	}
+
+	if cachedSignature != nil {
+		return cachedSignature, VerifyReleaseSignature(content, cachedSignature, keyring)
+	}
+
+	signatureURL := releaseURL + ReleaseSignatureSuffix
+	response, err := client.R().SetContext(ctx).Get(signatureURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode() == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s not found", ErrReleaseUnsigned, signatureURL)
+	}
+
+	if response.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to get release signature from %s - %s", signatureURL, response.Status())
+	}
+
+	return response.Body(), VerifyReleaseSignature(content, response.Body(), keyring)
+}
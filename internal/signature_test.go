@@ -0,0 +1,62 @@
+package internal_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/common"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyReleaseSignature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	otherPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	keyring, err := internal.ParseKeyring([]string{
+		base64.StdEncoding.EncodeToString(otherPublicKey),
+		base64.StdEncoding.EncodeToString(publicKey),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, keyring, 2)
+
+	content := []byte(common.SampleReleaseYAML)
+	signature := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, content)) + "\n")
+
+	err = internal.VerifyReleaseSignature(content, signature, keyring)
+	assert.NoError(t, err)
+
+	// tampered manifest
+	err = internal.VerifyReleaseSignature(append(content, []byte("\n# tampered")...), signature, keyring)
+	assert.ErrorIs(t, err, internal.ErrReleaseSignatureInvalid)
+	assert.True(t, internal.IsUntrustedRelease(err))
+
+	// signed by an unknown key
+	err = internal.VerifyReleaseSignature(content, signature, keyring[:1])
+	assert.ErrorIs(t, err, internal.ErrReleaseSignatureInvalid)
+
+	// unsigned manifest
+	err = internal.VerifyReleaseSignature(content, []byte{}, keyring)
+	assert.ErrorIs(t, err, internal.ErrReleaseUnsigned)
+
+	// malformed signature
+	err = internal.VerifyReleaseSignature(content, []byte("not a signature"), keyring)
+	assert.ErrorIs(t, err, internal.ErrReleaseSignatureInvalid)
+}
+
+func TestParseKeyring(t *testing.T) {
+	keyring, err := internal.ParseKeyring([]string{"", " "})
+	assert.NoError(t, err)
+	assert.Empty(t, keyring)
+
+	_, err = internal.ParseKeyring([]string{base64.StdEncoding.EncodeToString([]byte("too short"))})
+	assert.Error(t, err)
+
+	_, err = internal.ParseKeyring([]string{"%%%"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,247 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// the connection is closed outside of the download windows, the download is resumed in the next one.
+var errOutsideDownloadWindow = fmt.Errorf("outside of download windows")
+
+// how often a paused download checks if it is lifted
+const downloadWindowPollInterval = time.Minute
+
+// DownloadWindow is a range of local time in a day, which might go across midnight like `22:00-06:00`.
+type DownloadWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+func (w DownloadWindow) String() string {
+	format := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return format(w.Start) + "-" + format(w.End)
+}
+
+func (w DownloadWindow) contains(t time.Time) bool {
+	now := sinceMidnight(t)
+	if w.Start <= w.End {
+		return w.Start <= now && now < w.End
+	}
+	return now >= w.Start || now < w.End
+}
+
+// ParseDownloadWindows parses local time ranges like `01:00-06:00`.
+func ParseDownloadWindows(windows []string) ([]DownloadWindow, error) {
+	parsed := []DownloadWindow{}
+
+	for _, window := range windows {
+		window = strings.TrimSpace(window)
+		if window == "" {
+			continue
+		}
+
+		start, end, ok := strings.Cut(window, "-")
+		if !ok {
+			return nil, fmt.Errorf("download window `%s` is not like 01:00-06:00", window)
+		}
+
+		startTime, err := time.Parse("15:04", strings.TrimSpace(start))
+		if err != nil {
+			return nil, fmt.Errorf("download window `%s` is not like 01:00-06:00: %w", window, err)
+		}
+
+		endTime, err := time.Parse("15:04", strings.TrimSpace(end))
+		if err != nil {
+			return nil, fmt.Errorf("download window `%s` is not like 01:00-06:00: %w", window, err)
+		}
+
+		parsed = append(parsed, DownloadWindow{Start: sinceMidnight(startTime), End: sinceMidnight(endTime)})
+	}
+
+	return parsed, nil
+}
+
+// InDownloadWindows returns true if t is in any of the windows, or there is no window at all.
+func InDownloadWindows(windows []DownloadWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+
+	for _, window := range windows {
+		if window.contains(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NextDownloadWindow returns when the next window opens after t.
+func NextDownloadWindow(windows []DownloadWindow, t time.Time) time.Time {
+	var next time.Time
+
+	for _, window := range windows {
+		opens := t.Add(window.Start - sinceMidnight(t))
+		if !opens.After(t) {
+			opens = opens.AddDate(0, 0, 1)
+		}
+
+		if next.IsZero() || opens.Before(next) {
+			next = opens
+		}
+	}
+
+	return next
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+// DownloadLimiter enforces a rate limit and download windows on downloads with it, until it is lifted.
+type DownloadLimiter struct {
+	limiter *rate.Limiter
+	windows []DownloadWindow
+
+	// called when a download is paused outside of the windows, and resumed in one
+	OnPause  func(reason string)
+	OnResume func()
+
+	lifted  chan struct{}
+	once    sync.Once
+	waiting sync.Mutex
+}
+
+// NewDownloadLimiter returns a limiter of maxRate bytes per second, 0 for unlimited, within the windows.
+func NewDownloadLimiter(maxRate int64, windows []DownloadWindow) *DownloadLimiter {
+	l := &DownloadLimiter{
+		windows: windows,
+		lifted:  make(chan struct{}),
+	}
+
+	if maxRate > 0 {
+		l.limiter = rate.NewLimiter(rate.Limit(maxRate), int(maxRate))
+	}
+
+	return l
+}
+
+// Lift removes the limits, also from the downloads in progress.
+func (l *DownloadLimiter) Lift() {
+	l.once.Do(func() { close(l.lifted) })
+}
+
+func (l *DownloadLimiter) isLifted() bool {
+	select {
+	case <-l.lifted:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitForWindow blocks until a window opens or the limiter is lifted.
+func (l *DownloadLimiter) waitForWindow(ctx context.Context) error {
+	// segments of a download wait together, and the pause is reported once
+	l.waiting.Lock()
+	defer l.waiting.Unlock()
+
+	if l.isLifted() || InDownloadWindows(l.windows, time.Now()) {
+		return nil
+	}
+
+	if l.OnPause != nil {
+		next := NextDownloadWindow(l.windows, time.Now())
+		l.OnPause(fmt.Sprintf("paused outside of download windows %s, to resume at %s", l.windowsString(), next.Format("15:04")))
+	}
+
+	for !InDownloadWindows(l.windows, time.Now()) {
+		wait := time.Until(NextDownloadWindow(l.windows, time.Now()))
+		if wait > downloadWindowPollInterval {
+			wait = downloadWindowPollInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-l.lifted:
+			return l.resume()
+		case <-time.After(wait):
+		}
+	}
+
+	return l.resume()
+}
+
+func (l *DownloadLimiter) resume() error {
+	if l.OnResume != nil {
+		l.OnResume()
+	}
+	return nil
+}
+
+func (l *DownloadLimiter) windowsString() string {
+	windows := make([]string, 0, len(l.windows))
+	for _, window := range l.windows {
+		windows = append(windows, window.String())
+	}
+	return strings.Join(windows, ", ")
+}
+
+type downloadLimiterKey struct{}
+
+// WithDownloadLimiter returns a context which downloads with it are limited by the limiter.
+func WithDownloadLimiter(ctx context.Context, limiter *DownloadLimiter) context.Context {
+	return context.WithValue(ctx, downloadLimiterKey{}, limiter)
+}
+
+func downloadLimiterFrom(ctx context.Context) *DownloadLimiter {
+	limiter, _ := ctx.Value(downloadLimiterKey{}).(*DownloadLimiter)
+	return limiter
+}
+
+// limitedReader reads at the rate of the limiter, and stops when the download window is closed.
+type limitedReader struct {
+	ctx     context.Context
+	rc      io.ReadCloser
+	limiter *DownloadLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if r.limiter.isLifted() {
+		return r.rc.Read(p)
+	}
+
+	if !InDownloadWindows(r.limiter.windows, time.Now()) {
+		return 0, errOutsideDownloadWindow
+	}
+
+	if r.limiter.limiter == nil {
+		return r.rc.Read(p)
+	}
+
+	if burst := r.limiter.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err := r.rc.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.limiter.WaitN(r.ctx, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+
+	return n, err
+}
+
+func (r *limitedReader) Close() error {
+	return r.rc.Close()
+}
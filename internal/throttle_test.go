@@ -0,0 +1,83 @@
+package internal_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadWindows(t *testing.T) {
+	windows, err := internal.ParseDownloadWindows([]string{"01:00-06:00", " 22:30 - 23:00 ", ""})
+	assert.NoError(t, err)
+	assert.Len(t, windows, 2)
+	assert.Equal(t, "01:00-06:00", windows[0].String())
+
+	at := func(clock string) time.Time {
+		parsed, _ := time.ParseInLocation("2006-01-02 15:04", "2024-05-01 "+clock, time.Local)
+		return parsed
+	}
+
+	assert.True(t, internal.InDownloadWindows(windows, at("03:00")))
+	assert.True(t, internal.InDownloadWindows(windows, at("22:45")))
+	assert.False(t, internal.InDownloadWindows(windows, at("06:00")))
+	assert.Equal(t, at("22:30"), internal.NextDownloadWindow(windows, at("12:00")))
+	assert.Equal(t, at("01:00").AddDate(0, 0, 1), internal.NextDownloadWindow(windows, at("23:30")))
+
+	// across midnight
+	windows, err = internal.ParseDownloadWindows([]string{"22:00-06:00"})
+	assert.NoError(t, err)
+	assert.True(t, internal.InDownloadWindows(windows, at("23:00")))
+	assert.True(t, internal.InDownloadWindows(windows, at("05:00")))
+	assert.False(t, internal.InDownloadWindows(windows, at("12:00")))
+
+	assert.True(t, internal.InDownloadWindows(nil, at("12:00")))
+
+	_, err = internal.ParseDownloadWindows([]string{"1am-6am"})
+	assert.Error(t, err)
+}
+
+func TestDownloadLimiterLift(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "zimaos.raucb", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	// a window which is not now
+	start := time.Now().Add(2 * time.Hour).Format("15:04")
+	end := time.Now().Add(3 * time.Hour).Format("15:04")
+	windows, err := internal.ParseDownloadWindows([]string{start + "-" + end})
+	assert.NoError(t, err)
+
+	limiter := internal.NewDownloadLimiter(0, windows)
+
+	paused := make(chan string, 1)
+	limiter.OnPause = func(reason string) {
+		paused <- reason
+	}
+
+	go func() {
+		<-paused
+		limiter.Lift()
+	}()
+
+	outDir := t.TempDir()
+	filePath, err := internal.Download(internal.WithDownloadLimiter(context.Background(), limiter), outDir, server.URL+"/zimaos.raucb")
+	assert.NoError(t, err)
+
+	buf, err := os.ReadFile(filepath.Join(outDir, "zimaos.raucb"))
+	assert.NoError(t, err)
+	assert.Equal(t, content, buf)
+	assert.Equal(t, filepath.Join(outDir, "zimaos.raucb"), filePath)
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"io"
 
 	"github.com/hashicorp/go-getter"
@@ -48,3 +49,15 @@ func NewTracker(callback func(downladed, totalSize int64)) getter.ProgressTracke
 		callback: callback,
 	}
 }
+
+type downloadProgressKey struct{}
+
+// WithDownloadProgress returns a context which reports the progress of downloads with it to callback.
+func WithDownloadProgress(ctx context.Context, callback func(downloaded, totalSize int64)) context.Context {
+	return context.WithValue(ctx, downloadProgressKey{}, callback)
+}
+
+func downloadProgressCallback(ctx context.Context) func(downloaded, totalSize int64) {
+	callback, _ := ctx.Value(downloadProgressKey{}).(func(downloaded, totalSize int64))
+	return callback
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"golang.org/x/net/http/httpproxy"
+)
+
+var ErrUnsafeRedirect = fmt.Errorf("redirect to a scheme other than http or https")
+
+// transport is shared by every outbound request of the installer, so that the proxy and CA of `[network]` apply to all.
+var transport = http.DefaultTransport.(*http.Transport).Clone()
+
+// NewHTTPClient returns a client over the shared transport, see ConfigureNetwork. 0 is no timeout.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport:     transport,
+		Timeout:       timeout,
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// checkRedirect follows up to 10 redirects like the default client, but only to http and https. the transport serves
+// local mirrors too, which no server should be able to redirect to.
+func checkRedirect(request *http.Request, via []*http.Request) error {
+	if request.URL.Scheme != "http" && request.URL.Scheme != "https" {
+		return fmt.Errorf("%w: %s", ErrUnsafeRedirect, request.URL.Redacted())
+	}
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	return nil
+}
+
+// ConfigureNetwork applies the proxy and CA bundle to the shared transport. a proxy left empty is taken from the
+// environment like `HTTPS_PROXY`. it should be called before any request is made.
+func ConfigureNetwork(network *config.NetworkModel) error {
+	proxyConfig := httpproxy.FromEnvironment()
+	if network.HTTPProxy != "" {
+		proxyConfig.HTTPProxy = network.HTTPProxy
+	}
+	if network.HTTPSProxy != "" {
+		proxyConfig.HTTPSProxy = network.HTTPSProxy
+	}
+	if len(network.NoProxy) > 0 {
+		proxyConfig.NoProxy = strings.Join(network.NoProxy, ",")
+	}
+
+	for _, proxy := range []string{proxyConfig.HTTPProxy, proxyConfig.HTTPSProxy} {
+		if err := validateProxy(proxy); err != nil {
+			return err
+		}
+	}
+
+	proxyFunc := proxyConfig.ProxyFunc()
+	transport.Proxy = func(request *http.Request) (*url.URL, error) {
+		return proxyFunc(request.URL)
+	}
+
+	if network.CABundle != "" {
+		pool, err := loadCABundle(network.CABundle)
+		if err != nil {
+			return err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	transport.CloseIdleConnections()
+	return nil
+}
+
+// validateProxy accepts an http, https or socks5 proxy URL, or an empty one for no proxy.
+func validateProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+
+	// a proxy without scheme like `proxy:3128` is taken as http by httpproxy
+	if !strings.Contains(proxy, "://") {
+		return nil
+	}
+
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return fmt.Errorf("invalid proxy `%s`: %w", proxy, err)
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return nil
+	default:
+		return fmt.Errorf("unsupported scheme of proxy `%s`, expected http, https or socks5", proxy)
+	}
+}
+
+// loadCABundle returns the system CAs with the ones in the PEM file added.
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+
+	if !pool.AppendCertsFromPEM(buf) {
+		return nil, fmt.Errorf("no certificate found in CA bundle %s", path)
+	}
+
+	return pool, nil
+}
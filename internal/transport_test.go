@@ -0,0 +1,66 @@
+package internal_test
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigureNetwork(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, internal.ConfigureNetwork(&config.NetworkModel{}))
+	})
+
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r.URL.String()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	// requests go through the proxy
+	assert.NoError(t, internal.ConfigureNetwork(&config.NetworkModel{HTTPProxy: proxy.URL}))
+
+	response, err := internal.NewHTTPClient(0).Get("http://mirror.example/rauc.txt")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, "http://mirror.example/rauc.txt", <-proxied)
+
+	// except the ones in no_proxy
+	assert.NoError(t, internal.ConfigureNetwork(&config.NetworkModel{HTTPProxy: proxy.URL, NoProxy: []string{".example"}}))
+
+	_, err = internal.NewHTTPClient(0).Get("http://mirror.example/rauc.txt")
+	assert.Error(t, err)
+	assert.Empty(t, proxied)
+
+	assert.Error(t, internal.ConfigureNetwork(&config.NetworkModel{HTTPSProxy: "ftp://proxy:21"}))
+	assert.NoError(t, internal.ConfigureNetwork(&config.NetworkModel{HTTPSProxy: "socks5://proxy:1080"}))
+
+	// a server with a certificate of an unknown CA is trusted with the CA bundle
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	assert.NoError(t, internal.ConfigureNetwork(&config.NetworkModel{}))
+	_, err = internal.NewHTTPClient(0).Get(server.URL)
+	assert.Error(t, err)
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(t, os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+
+	assert.NoError(t, internal.ConfigureNetwork(&config.NetworkModel{CABundle: bundle}))
+	response, err = internal.NewHTTPClient(0).Get(server.URL)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	assert.Error(t, internal.ConfigureNetwork(&config.NetworkModel{CABundle: filepath.Join(t.TempDir(), "missing.pem")}))
+}
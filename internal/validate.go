@@ -0,0 +1,197 @@
+package internal
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/common"
+	"github.com/samber/lo"
+)
+
+var ErrInvalidRelease = fmt.Errorf("invalid release")
+
+var KnownArchitectures = []string{string(codegen.Amd64), string(codegen.Arm64), string(codegen.Arm7), string(codegen.Any)}
+
+// common misspellings of architectures
+var architectureAliases = map[string]string{
+	"x86_64":  string(codegen.Amd64),
+	"x64":     string(codegen.Amd64),
+	"aarch64": string(codegen.Arm64),
+	"armv8":   string(codegen.Arm64),
+	"arm":     string(codegen.Arm7),
+	"armv7":   string(codegen.Arm7),
+	"armv7l":  string(codegen.Arm7),
+	"armhf":   string(codegen.Arm7),
+	"arm7":    string(codegen.Arm7),
+}
+
+type ReleaseValidationError struct {
+	Problems []codegen.ReleaseProblem
+}
+
+func (e *ReleaseValidationError) Error() string {
+	messages := lo.FilterMap(e.Problems, func(problem codegen.ReleaseProblem, _ int) (string, bool) {
+		return problem.Field + ": " + problem.Message, problem.Severity == codegen.Error
+	})
+	return ErrInvalidRelease.Error() + ": " + strings.Join(messages, "; ")
+}
+
+func (e *ReleaseValidationError) Unwrap() error {
+	return ErrInvalidRelease
+}
+
+// HasReleaseError returns true if any of the problems is an error rather than a warning
+func HasReleaseError(problems []codegen.ReleaseProblem) bool {
+	return lo.ContainsBy(problems, func(problem codegen.ReleaseProblem) bool {
+		return problem.Severity == codegen.Error
+	})
+}
+
+// CheckRelease returns a *ReleaseValidationError if the release has any error. warnings are ignored.
+func CheckRelease(release codegen.Release) error {
+	problems := ValidateRelease(release)
+	if HasReleaseError(problems) {
+		return &ReleaseValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ValidateRelease returns field-level problems of the release against the running device.
+func ValidateRelease(release codegen.Release) []codegen.ReleaseProblem {
+	problems := []codegen.ReleaseProblem{}
+
+	report := func(severity codegen.ReleaseProblemSeverity, field string, format string, args ...any) {
+		problems = append(problems, codegen.ReleaseProblem{
+			Field:    field,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	checkPlaceholders := func(field, value string) {
+		for _, placeholder := range UnknownPlaceholders(value) {
+			report(codegen.Warning, field, "unknown placeholder `%s`, expected one of %s", placeholder, strings.Join(KnownPlaceholders, ", "))
+		}
+	}
+
+	// paths are relative to the mirror, unless they start with ${MIRROR}
+	checkPath := func(field, path string) {
+		if IsMirrorRelative(path) && !strings.HasPrefix(path, "/") {
+			report(codegen.Error, field, "path `%s` must start with `/` or `%s`", path, common.MirrorPlaceHolder)
+		}
+		checkPlaceholders(field, path)
+	}
+
+	if strings.TrimSpace(release.Version) == "" {
+		report(codegen.Error, "version", "version is required")
+	}
+
+	if strings.TrimSpace(release.ReleaseNotes) == "" {
+		report(codegen.Warning, "release_notes", "release notes are empty")
+	}
+
+	// offline bundles can go without mirrors, the download will fail otherwise
+	if len(release.Mirrors) == 0 {
+		report(codegen.Warning, "mirrors", "no mirror is given, the release can only be installed offline")
+	}
+
+	for i, mirror := range release.Mirrors {
+		// a local mirror has no host, see IsLocalMirror
+		if u, err := url.Parse(mirror); err != nil || u.Scheme == "" || (u.Host == "" && !IsLocalMirror(mirror)) {
+			report(codegen.Error, fmt.Sprintf("mirrors[%d]", i), "`%s` is not an absolute url", mirror)
+		}
+	}
+
+	device := CurrentDevice()
+
+	for i, pkg := range release.Packages {
+		field := fmt.Sprintf("packages[%d]", i)
+
+		if pkg.Path == "" {
+			report(codegen.Error, field+".path", "path is required")
+		} else {
+			checkPath(field+".path", pkg.Path)
+		}
+
+		if pkg.Deltas != nil {
+			for j, delta := range *pkg.Deltas {
+				deltaField := fmt.Sprintf("%s.deltas[%d]", field, j)
+
+				if delta.FromVersion == "" {
+					report(codegen.Error, deltaField+".from_version", "from_version is required")
+				}
+
+				if delta.Path == "" {
+					report(codegen.Error, deltaField+".path", "path is required")
+				} else {
+					checkPath(deltaField+".path", delta.Path)
+				}
+
+				if _, ok := deltaTools[delta.Type]; !ok {
+					report(codegen.Warning, deltaField+".type", "unknown delta type `%s`, the full package is downloaded instead", delta.Type)
+				}
+			}
+		}
+
+		if !lo.Contains(KnownArchitectures, string(pkg.Architecture)) {
+			if alias, ok := architectureAliases[strings.ToLower(string(pkg.Architecture))]; ok {
+				report(codegen.Warning, field+".architecture", "unknown architecture `%s`, did you mean `%s`?", pkg.Architecture, alias)
+			} else {
+				report(codegen.Warning, field+".architecture", "unknown architecture `%s`, expected one of %s", pkg.Architecture, strings.Join(KnownArchitectures, ", "))
+			}
+		}
+	}
+
+	if _, ok := SelectPackage(release, device); !ok {
+		report(codegen.Error, "packages", "no package for this device, with %s", device)
+	}
+
+	if release.Checksums == "" {
+		report(codegen.Error, "checksums", "checksums is required")
+	} else {
+		checkPath("checksums", release.Checksums)
+	}
+
+	if release.ChecksumAlgorithm != nil && !lo.Contains(ChecksumAlgorithms, *release.ChecksumAlgorithm) {
+		report(codegen.Error, "checksum_algorithm", "unsupported checksum algorithm `%s`, expected one of %v", *release.ChecksumAlgorithm, ChecksumAlgorithms)
+	}
+
+	if release.Rollout != nil && release.Rollout.Percentage != nil {
+		if percentage := *release.Rollout.Percentage; percentage < 0 || percentage > 100 {
+			report(codegen.Error, "rollout.percentage", "percentage %d must be between 0 and 100", percentage)
+		}
+	}
+
+	hasMinFromVersion := release.MinFromVersion != nil && *release.MinFromVersion != ""
+	hasRequiredIntermediate := release.RequiredIntermediate != nil && *release.RequiredIntermediate != ""
+	if hasMinFromVersion && !hasRequiredIntermediate {
+		report(codegen.Warning, "required_intermediate", "devices older than %s cannot upgrade without a required intermediate", *release.MinFromVersion)
+	}
+	if hasRequiredIntermediate && !hasMinFromVersion {
+		report(codegen.Warning, "min_from_version", "required intermediate %s is ignored without min_from_version", *release.RequiredIntermediate)
+	}
+
+	if release.Background != nil {
+		checkPlaceholders("background", *release.Background)
+	}
+	checkPlaceholders("release_notes", release.ReleaseNotes)
+
+	if release.LocalizedReleaseNotes != nil {
+		locales := lo.Keys(*release.LocalizedReleaseNotes)
+		sort.Strings(locales)
+
+		for _, locale := range locales {
+			notes := (*release.LocalizedReleaseNotes)[locale]
+			field := "localized_release_notes." + locale
+			if strings.TrimSpace(notes) == "" {
+				report(codegen.Warning, field, "release notes are empty, `release_notes` is used instead")
+			}
+			checkPlaceholders(field, notes)
+		}
+	}
+
+	return problems
+}
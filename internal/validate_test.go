@@ -0,0 +1,79 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/common"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func problemOf(problems []codegen.ReleaseProblem, field string) *codegen.ReleaseProblem {
+	problem, ok := lo.Find(problems, func(problem codegen.ReleaseProblem) bool {
+		return problem.Field == field
+	})
+	if !ok {
+		return nil
+	}
+	return &problem
+}
+
+func TestValidateRelease(t *testing.T) {
+	release, err := internal.ParseRelease([]byte(common.SampleReleaseYAML))
+	assert.NoError(t, err)
+
+	problems := internal.ValidateRelease(*release)
+	assert.False(t, internal.HasReleaseError(problems))
+
+	// the sample release uses `armv7` instead of `arm-7`
+	problem := problemOf(problems, "packages[2].architecture")
+	if assert.NotNil(t, problem) {
+		assert.Equal(t, codegen.Warning, problem.Severity)
+		assert.Contains(t, problem.Message, "arm-7")
+	}
+
+	_, err = internal.GetReleaseFromContent([]byte(common.SampleReleaseYAML))
+	assert.NoError(t, err)
+}
+
+func TestValidateMalformedRelease(t *testing.T) {
+	release := codegen.Release{
+		Mirrors: []string{"casaos.io/no/scheme"},
+		Packages: []codegen.Package{
+			{Path: "get/casaos.tar.gz", Architecture: codegen.PackageArchitecture(internal.CurrentArchitecture())},
+		},
+		Checksums:         "get/checksums.txt",
+		ChecksumAlgorithm: lo.ToPtr(codegen.ReleaseChecksumAlgorithm("md5")),
+	}
+
+	problems := internal.ValidateRelease(release)
+	assert.True(t, internal.HasReleaseError(problems))
+
+	for _, field := range []string{"version", "mirrors[0]", "packages[0].path", "checksums", "checksum_algorithm"} {
+		problem := problemOf(problems, field)
+		if assert.NotNil(t, problem, field) {
+			assert.Equal(t, codegen.Error, problem.Severity, field)
+		}
+	}
+
+	err := internal.CheckRelease(release)
+	assert.ErrorIs(t, err, internal.ErrInvalidRelease)
+
+	var validationErr *internal.ReleaseValidationError
+	if assert.ErrorAs(t, err, &validationErr) {
+		assert.Equal(t, problems, validationErr.Problems)
+	}
+
+	// no package for this device
+	release = codegen.Release{
+		Version:   "v1.0.0",
+		Packages:  []codegen.Package{},
+		Checksums: "/checksums.txt",
+	}
+	problem := problemOf(internal.ValidateRelease(release), "packages")
+	if assert.NotNil(t, problem) {
+		assert.Equal(t, codegen.Error, problem.Severity)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	util_http "github.com/IceWhaleTech/CasaOS-Common/utils/http"
 
 	"github.com/IceWhaleTech/CasaOS-Installer/common"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
 	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
 	"github.com/IceWhaleTech/CasaOS-Installer/route"
 	"github.com/IceWhaleTech/CasaOS-Installer/service"
@@ -80,18 +81,24 @@ func init() {
 
 	logger.LogInit(config.AppInfo.LogPath, config.AppInfo.LogSaveName, config.AppInfo.LogFileExt)
 
+	if err := internal.ConfigureNetwork(config.NetworkInfo); err != nil {
+		logger.Error("error when trying to configure network - requests might fail behind a proxy", zap.Error(err))
+	}
+	internal.ConfigureRetry(config.RetryInfo)
+
 	service.MyService = service.NewService(config.CommonInfo.RuntimePath)
-	go func() {
-		var releaseURL []string
-		for _, mirror := range config.ServerInfo.Mirrors {
-			releaseURL = append(releaseURL, service.HyperFileTagReleaseURL(service.GetReleaseBranch(sysRoot), mirror))
-		}
-		var best service.BestURLFunc = service.BestByDelay // dependency inject
-		best(releaseURL)
-	}()
+	service.Mirrors = service.NewMirrorManager(service.MirrorStatsPath())
+
+	if config.ShareInfo.Enabled || config.ShareInfo.Mirror {
+		service.PeerSharing = service.NewPeerShare(internal.PeerInstanceName(config.ShareInfo.Port))
+		service.PeerSharing.Mirror = config.ShareInfo.Mirror
+	}
+	go probeMirrors(context.Background())
 }
 
 func main() {
+	defer service.Mirrors.Flush()
+
 	service.InstallerService = service.NewStatusService(service.NewInstallerService(sysRoot), sysRoot)
 
 	err := service.InstallerService.Launch(sysRoot)
@@ -140,6 +147,15 @@ func main() {
 
 	go registerRouter(listener)
 
+	if service.PeerSharing != nil {
+		go service.PeerSharing.PublishCached()
+		go func() {
+			if err := service.SharePeers(ctx); err != nil {
+				logger.Error("error when trying to share releases with peers", zap.Error(err))
+			}
+		}()
+	}
+
 	// should do before cron job to prevent stop by `installing` status
 	err = service.InstallerService.PostMigration(sysRoot)
 	if err != nil {
@@ -161,6 +177,11 @@ func main() {
 			logger.Error("error when trying to add cron job", zap.Error(err))
 		}
 
+		// mirrors go down and come back, and the channel can be changed at any time.
+		if _, err := crontab.AddFunc("@every 10m", func() { probeMirrors(ctx) }); err != nil {
+			logger.Error("error when trying to add mirror probe job", zap.Error(err))
+		}
+
 		crontab.Start()
 		defer crontab.Stop()
 	}
@@ -184,6 +205,10 @@ func cronjob(ctx context.Context) {
 	}
 }
 
+func probeMirrors(ctx context.Context) {
+	service.Mirrors.Probe(ctx, service.GetReleaseBranch(sysRoot), service.HyperFileTagReleaseURL)
+}
+
 func watchOfflineDir(watcher *fsnotify.Watcher) {
 	// Start listening for events.
 	go func() {
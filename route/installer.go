@@ -2,8 +2,10 @@ package route
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
-	"time"
 
 	"github.com/IceWhaleTech/CasaOS-Common/utils"
 	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
@@ -33,15 +35,13 @@ func (a *api) GetStatus(ctx echo.Context) error {
 
 func (a *api) GetRelease(c echo.Context, params codegen.GetReleaseParams) error {
 	tag := service.GetReleaseBranch(config.SysRoot)
-	if params.Version != nil && *params.Version != "latest" {
-		tag = *params.Version
-	}
 
 	ctx := context.WithValue(context.Background(), types.Trigger, types.HTTP_REQUEST)
-	release, err := service.InstallerService.GetRelease(ctx, tag, true)
+
+	release, err := getRelease(ctx, tag, params.Version)
 	if err != nil {
 		message := err.Error()
-		if err == service.ErrReleaseNotFound {
+		if errors.Is(err, service.ErrReleaseNotFound) {
 			return c.JSON(http.StatusNotFound, &codegen.ResponseNotFound{
 				Message: &message,
 			})
@@ -57,11 +57,107 @@ func (a *api) GetRelease(c echo.Context, params codegen.GetReleaseParams) error
 		})
 	}
 
-	release.Background = utils.Ptr("/v2/installer/background?version=" + release.Version)
+	// work on a copy, the release is cached by the installer service
+	localized := *release
+	localized.ReleaseNotes = internal.LocalizedReleaseNotes(*release, localePreferences(c, params.Lang))
+	localized.Background = utils.Ptr("/v2/installer/background?version=" + release.Version)
 
 	return c.JSON(http.StatusOK, &codegen.ReleaseOK{
-		Data:       release,
+		Data:       &localized,
 		Upgradable: nil,
+		Rollout:    lo.ToPtr(service.GetRolloutStatus(*release, config.SysRoot)),
+	})
+}
+
+// getRelease returns the release of version from the release index, or the latest one of the channel if version is not given.
+func getRelease(ctx context.Context, tag string, version *codegen.Version) (*codegen.Release, error) {
+	if version != nil && *version != "latest" {
+		return service.GetReleaseByVersion(ctx, tag, *version)
+	}
+	return service.InstallerService.GetRelease(ctx, tag, true)
+}
+
+func (a *api) GetUpgradePlan(c echo.Context, params codegen.GetUpgradePlanParams) error {
+	tag := service.GetReleaseBranch(config.SysRoot)
+
+	ctx := context.WithValue(context.Background(), types.Trigger, types.HTTP_REQUEST)
+
+	release, err := getRelease(ctx, tag, params.Version)
+	if err == nil && release == nil {
+		err = fmt.Errorf("release is fetching")
+	}
+
+	var plan codegen.UpgradePlan
+	if err == nil {
+		plan, err = service.GetUpgradePlan(ctx, tag, *release, config.SysRoot)
+	}
+
+	if err != nil {
+		message := err.Error()
+		if errors.Is(err, service.ErrReleaseNotFound) {
+			return c.JSON(http.StatusNotFound, &codegen.ResponseNotFound{
+				Message: &message,
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, &codegen.ResponseInternalServerError{
+			Message: &message,
+		})
+	}
+
+	return c.JSON(http.StatusOK, &codegen.UpgradePlanOK{
+		Data: &plan,
+	})
+}
+
+// localePreferences returns the locales the client prefers, `lang` goes before Accept-Language.
+func localePreferences(c echo.Context, lang *codegen.Lang) []string {
+	preferences := internal.ParseAcceptLanguage(c.Request().Header.Get("Accept-Language"))
+	if lang != nil && *lang != "" {
+		preferences = append([]string{*lang}, preferences...)
+	}
+	return preferences
+}
+
+func (a *api) GetReleases(ctx echo.Context) error {
+	releases, err := service.ListReleases(ctx.Request().Context(), service.GetReleaseBranch(config.SysRoot), config.SysRoot)
+	if err != nil {
+		message := err.Error()
+		if errors.Is(err, service.ErrReleaseNotFound) {
+			return ctx.JSON(http.StatusNotFound, &codegen.ResponseNotFound{
+				Message: &message,
+			})
+		}
+		return ctx.JSON(http.StatusInternalServerError, &codegen.ResponseInternalServerError{
+			Message: &message,
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, &codegen.ReleasesOK{
+		Data: &releases,
+	})
+}
+
+func (a *api) ValidateRelease(ctx echo.Context) error {
+	content, err := io.ReadAll(ctx.Request().Body)
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, &codegen.ResponseInternalServerError{
+			Message: lo.ToPtr(err.Error()),
+		})
+	}
+
+	release, err := internal.ParseRelease(content)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, &codegen.ResponseBadRequest{
+			Message: lo.ToPtr("failed to parse release: " + err.Error()),
+		})
+	}
+
+	problems := internal.ValidateRelease(*release)
+	return ctx.JSON(http.StatusOK, &codegen.ReleaseValidationOK{
+		Data: &codegen.ReleaseValidation{
+			Valid:    !internal.HasReleaseError(problems),
+			Problems: problems,
+		},
 	})
 }
 
@@ -70,7 +166,13 @@ func (a *api) InstallRelease(ctx echo.Context, params codegen.InstallReleasePara
 
 	service.InstallerService.UpdateStatusWithMessage(service.InstallBegin, types.FETCHING)
 
-	if status.Status == codegen.Downloading {
+	if status.Status == codegen.Downloading || status.Status == codegen.DownloadPaused {
+		// the user is waiting for it, so the download in background is not limited any more
+		service.InstallerService.LiftDownloadLimits()
+		if err := service.InstallerService.ResumeDownload(); err == nil {
+			logger.Info("download paused by the user is resumed for install")
+		}
+
 		message := "downloading"
 		return ctx.JSON(http.StatusOK, &codegen.ResponseOK{
 			Message: &message,
@@ -87,12 +189,12 @@ func (a *api) InstallRelease(ctx echo.Context, params codegen.InstallReleasePara
 	go func() {
 		tag := service.GetReleaseBranch(config.SysRoot)
 
-		if params.Version != nil && *params.Version != "latest" {
-			tag = *params.Version
-		}
-
 		ctx := context.WithValue(context.Background(), types.Trigger, types.INSTALL)
-		release, err := service.InstallerService.GetRelease(ctx, tag, true)
+
+		release, err := getRelease(ctx, tag, params.Version)
+		if err == nil && release != nil && params.Version != nil && *params.Version != "latest" {
+			err = service.CheckInstallPolicy(release.Version, config.SysRoot)
+		}
 		if err != nil {
 			message := err.Error()
 			service.InstallerService.UpdateStatusWithMessage(service.InstallError, message)
@@ -104,34 +206,30 @@ func (a *api) InstallRelease(ctx echo.Context, params codegen.InstallReleasePara
 			return
 		}
 
-		// if the err is not nil. It mean should to download
-
-		releasePath, err := service.InstallerService.DownloadRelease(ctx, *release, false)
+		// one step at a time, the next one is installed after the device restarts into this one
+		release, err = service.NextUpgradeStep(ctx, tag, *release, config.SysRoot)
+		if err == nil {
+			err = service.CheckRevoked(release.Version)
+		}
 		if err != nil {
 			service.InstallerService.UpdateStatusWithMessage(service.InstallError, err.Error())
-			logger.Error("error while downloading release: %s")
 			return
 		}
-		time.Sleep(3 * time.Second)
 
-		err = service.InstallerService.ExtractRelease(releasePath, *release)
-		if err != nil {
-			logger.Error("error while extract release: %s", zap.Error(err))
-			return
-		}
-		time.Sleep(3 * time.Second)
+		// if the err is not nil. It mean should to download
 
-		err = service.InstallerService.Install(*release, config.SysRoot)
-		if err != nil {
-			logger.Error("error while install system: %s", zap.Error(err))
+		releasePath, err := service.InstallerService.DownloadRelease(ctx, *release, false)
+		if service.IsDownloadStopped(err) {
+			logger.Info("download is stopped by the user", zap.Error(err))
 			return
 		}
-
-		err = service.InstallerService.PostInstall(*release, config.SysRoot)
 		if err != nil {
-			logger.Error("error while post install system: %s", zap.Error(err))
+			service.InstallerService.UpdateStatusWithMessage(service.InstallError, err.Error())
+			logger.Error("error while downloading release: %s")
 			return
 		}
+
+		service.InstallerService.InstallDownloadedRelease(releasePath, *release)
 	}()
 
 	message := "release being installed asynchronously"
@@ -183,6 +281,54 @@ func (a *api) GetInstall(ctx echo.Context) error {
 	})
 }
 
+func (a *api) CancelDownload(ctx echo.Context) error {
+	return downloadControlResponse(ctx, service.InstallerService.CancelDownload())
+}
+
+func (a *api) PauseDownload(ctx echo.Context) error {
+	return downloadControlResponse(ctx, service.InstallerService.PauseDownload())
+}
+
+func (a *api) ResumeDownload(ctx echo.Context) error {
+	return downloadControlResponse(ctx, service.InstallerService.ResumeDownload())
+}
+
+func downloadControlResponse(ctx echo.Context, err error) error {
+	if err != nil {
+		return ctx.JSON(http.StatusNotFound, &codegen.ResponseNotFound{
+			Message: lo.ToPtr(err.Error()),
+		})
+	}
+	return ctx.JSON(http.StatusOK, &codegen.ResponseOK{
+		Message: lo.ToPtr("ok"),
+	})
+}
+
+func (a *api) GetMirrors(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, &codegen.MirrorsOK{
+		Data: lo.ToPtr(service.Mirrors.Stats()),
+	})
+}
+
+// GetDiagnostics implements codegen.ServerInterface.
+func (a *api) GetDiagnostics(ctx echo.Context) error {
+	policy := internal.RetryPolicy()
+
+	return ctx.JSON(http.StatusOK, &codegen.DiagnosticsOK{
+		Data: &codegen.Diagnostics{
+			RetryPolicy: &codegen.RetryPolicy{
+				Attempts:          policy.Attempts,
+				WaitTimeMs:        policy.WaitTime.Milliseconds(),
+				MaxWaitTimeMs:     policy.MaxWaitTime.Milliseconds(),
+				ProbeTimeoutMs:    policy.ProbeTimeout.Milliseconds(),
+				BreakerThreshold:  policy.BreakerThreshold,
+				BreakerCooldownMs: policy.BreakerCooldown.Milliseconds(),
+			},
+			Mirrors: service.Mirrors.Stats(),
+		},
+	})
+}
+
 // GetBetaSubscriptionStatus implements codegen.ServerInterface.
 func (a *api) GetBetaSubscriptionStatus(ctx echo.Context) error {
 	beta, err := service.GetBetaSubscriptionStatus()
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
 	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
 	"github.com/IceWhaleTech/CasaOS-Installer/service"
 	"github.com/IceWhaleTech/CasaOS-Installer/types"
@@ -11,7 +12,7 @@ import (
 	"github.com/samber/lo"
 )
 
-func (a *api) GetNoticeInfo(c echo.Context) error {
+func (a *api) GetNoticeInfo(c echo.Context, params codegen.GetNoticeInfoParams) error {
 	ctx := c.Request().Context()
 	tag := service.GetReleaseBranch(config.SysRoot)
 	release, err := service.InstallerService.GetRelease(ctx, tag, true)
@@ -29,13 +30,16 @@ func (a *api) GetNoticeInfo(c echo.Context) error {
 
 	switch packageStatus {
 	case types.READY_TO_UPDATE:
+		releaseNotes := internal.LocalizedReleaseNotes(*release, localePreferences(c, params.Lang))
 		if release.Important != nil && *release.Important {
 			return c.JSON(http.StatusOK, &codegen.NoticeInfoOK{
-				Data: lo.ToPtr(codegen.ImportantUpdate),
+				Data:         lo.ToPtr(codegen.ImportantUpdate),
+				ReleaseNotes: &releaseNotes,
 			})
 		}
 		return c.JSON(http.StatusOK, &codegen.NoticeInfoOK{
-			Data: lo.ToPtr(codegen.NormalUpdate),
+			Data:         lo.ToPtr(codegen.NormalUpdate),
+			ReleaseNotes: &releaseNotes,
 		})
 	default:
 		return c.JSON(http.StatusOK, &codegen.NoticeInfoOK{
@@ -2,19 +2,22 @@ package service
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
 	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
 	"github.com/IceWhaleTech/CasaOS-Installer/common"
 	"github.com/IceWhaleTech/CasaOS-Installer/internal"
 	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
 )
 
+var ErrChecksumNotVouched = fmt.Errorf("checksum is not vouched by any trusted origin")
+
 func DownloadChecksum(ctx context.Context, release codegen.Release, mirror string) (string, error) {
 	releaseDir, err := config.ReleaseDir(release)
 	if err != nil {
@@ -25,28 +28,124 @@ func DownloadChecksum(ctx context.Context, release codegen.Release, mirror strin
 	return internal.Download(ctx, releaseDir, checksumURL)
 }
 
-// sha256sum
-func VerifyChecksumByFilePath(filepath, checksum string) error {
-	file, err := os.Open(filepath)
+// ChecksumOrigins returns the origins to fetch checksums.txt from, see config.ServerModel.ChecksumOrigins. without a
+// designated origin the mirrors of installer.conf are asked rather than the ones listed by the manifest, which comes
+// from a mirror too.
+func ChecksumOrigins() []string {
+	if len(config.ServerInfo.ChecksumOrigins) > 0 {
+		return config.ServerInfo.ChecksumOrigins
+	}
+	return lo.Uniq(config.ServerInfo.Mirrors)
+}
+
+// ChecksumQuorum returns how many origins have to vouch for the checksum, see config.ServerModel.ChecksumQuorum.
+func ChecksumQuorum() int {
+	return max(config.ServerInfo.ChecksumQuorum, 1)
+}
+
+// DownloadTrustedChecksums fetches checksums.txt from every checksum origin, independent of the mirror
+// the package is downloaded from. checksums.txt is written to the release dir only if all origins that
+// answered agree on the checksum of the package, and at least ChecksumQuorum of them answered. returns the
+// origins which vouched for the checksum.
+func DownloadTrustedChecksums(ctx context.Context, release codegen.Release) ([]string, error) {
+	releaseDir, err := config.ReleaseDir(release)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	packageURL, err := internal.GetPackageURLByCurrentArch(release, "")
+	if err != nil {
+		return nil, err
+	}
+	packageFilename := filepath.Base(packageURL)
+
+	var content []byte
+	vouched := map[internal.Checksum][]string{} // checksum => origins
+
+	checksumOrigins := ChecksumOrigins()
+	for _, origin := range checksumOrigins {
+		checksumsURL := internal.GetChecksumsURL(release, origin)
+
+		buf, checksums, err := internal.GetChecksumsFrom(ctx, checksumsURL, internal.ChecksumAlgorithm(release))
+		if err != nil {
+			logger.Error("error while getting checksums - skipping", zap.Error(err), zap.String("checksums_url", checksumsURL))
+			continue
+		}
+
+		packageChecksum, ok := checksums[packageFilename]
+		if !ok {
+			logger.Error("package is not listed in checksums - skipping", zap.String("checksums_url", checksumsURL), zap.String("package", packageFilename))
+			continue
+		}
+
+		if len(vouched) == 0 {
+			content = buf
+		}
+		vouched[packageChecksum] = append(vouched[packageChecksum], origin)
+	}
+
+	if len(vouched) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrChecksumNotVouched, packageFilename)
+	}
+
+	if len(vouched) > 1 {
+		disagreement := []string{}
+		for checksum, origins := range vouched {
+			disagreement = append(disagreement, fmt.Sprintf("%s from %s", checksum, strings.Join(origins, ",")))
+		}
+		return nil, fmt.Errorf("checksum origins disagree on %s: %s", packageFilename, strings.Join(disagreement, "; "))
+	}
+
+	var origins []string
+	for _, vouchedOrigins := range vouched {
+		origins = vouchedOrigins
 	}
-	defer file.Close()
 
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return err
+	if quorum := ChecksumQuorum(); len(origins) < quorum {
+		return nil, fmt.Errorf("%w: %s is vouched by %d origin(s), %d needed", ErrChecksumNotVouched, packageFilename, len(origins), quorum)
 	}
 
-	buf := hash.Sum(nil)[:32]
-	if hex.EncodeToString(buf) != checksum {
-		return fmt.Errorf("checksum mismatch: expected %s, got %s", checksum, hex.EncodeToString(buf))
+	// nothing to compare with, e.g. a channel or a local mirror with a single mirror, or the others are not reachable
+	if len(origins) == 1 {
+		logger.Info("warning: checksum is vouched by a single origin", zap.String("package", packageFilename), zap.String("origin", origins[0]), zap.Strings("checksum_origins", checksumOrigins))
 	}
 
-	return nil
+	if err := os.MkdirAll(releaseDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(filepath.Join(releaseDir, common.ChecksumsTXTFileName), content, 0o600); err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(filepath.Join(releaseDir, common.ChecksumsOriginFileName), []byte(strings.Join(origins, "\n")+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+
+	logger.Info("checksums vouched", zap.String("package", packageFilename), zap.Strings("origins", origins))
+	return origins, nil
+}
+
+// checksumVerifier verifies a download against the checksum of filename in checksums.txt of the release
+func checksumVerifier(release codegen.Release, filename string) internal.DownloadVerifier {
+	return func(partPath string) error {
+		checksums, err := GetChecksums(release)
+		if err != nil {
+			return err
+		}
+
+		checksum, ok := checksums[filename]
+		if !ok {
+			return fmt.Errorf("%s is not listed in checksums", filename)
+		}
+
+		return internal.VerifyChecksum(partPath, checksum)
+	}
 }
 
-func GetChecksums(release codegen.Release) (map[string]string, error) {
+// GetChecksums returns the checksums in checksums.txt of the release, of the algorithm it declares unless a line names
+// another.
+func GetChecksums(release codegen.Release) (map[string]internal.Checksum, error) {
 	releaseDir, err := config.ReleaseDir(release)
 	if err != nil {
 		return nil, err
@@ -54,5 +153,5 @@ func GetChecksums(release codegen.Release) (map[string]string, error) {
 
 	checksumsFilePath := filepath.Join(releaseDir, common.ChecksumsTXTFileName)
 
-	return internal.GetChecksums(checksumsFilePath)
+	return internal.GetChecksums(checksumsFilePath, internal.ChecksumAlgorithm(release))
 }
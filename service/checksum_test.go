@@ -0,0 +1,172 @@
+package service_test
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/common"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/IceWhaleTech/CasaOS-Installer/service"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func newChecksumsServer(content string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/release/checksums.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+}
+
+func checksumsTestRelease(mirrors ...string) codegen.Release {
+	return codegen.Release{
+		Version: "v99.0.0",
+		Mirrors: mirrors,
+		Packages: []codegen.Package{
+			{Path: "/release/zimaos-99.0.0.raucb", Architecture: codegen.Amd64},
+			{Path: "/release/zimaos-99.0.0.raucb", Architecture: codegen.Arm64},
+			{Path: "/release/zimaos-99.0.0.raucb", Architecture: codegen.Arm7},
+		},
+		Checksums: "/release/checksums.txt",
+	}
+}
+
+// withMirrors sets the mirrors of installer.conf until the test is done
+func withMirrors(t *testing.T, mirrors ...string) {
+	saved := config.ServerInfo.Mirrors
+	t.Cleanup(func() { config.ServerInfo.Mirrors = saved })
+	config.ServerInfo.Mirrors = mirrors
+}
+
+func TestDownloadTrustedChecksums(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	config.ServerInfo.CachePath = t.TempDir()
+	defer func() { config.ServerInfo.ChecksumOrigins = nil }()
+
+	good := newChecksumsServer("1234 zimaos-99.0.0.raucb\n")
+	defer good.Close()
+
+	alsoGood := newChecksumsServer("1234 zimaos-99.0.0.raucb\n5678 other.raucb\n")
+	defer alsoGood.Close()
+
+	stale := newChecksumsServer("abcd zimaos-99.0.0.raucb\n")
+	defer stale.Close()
+
+	broken := httptest.NewServer(http.NotFoundHandler())
+	defer broken.Close()
+
+	ctx := context.Background()
+
+	// all mirrors agree, the broken one is skipped. the mirrors listed by the manifest are not asked
+	withMirrors(t, good.URL, alsoGood.URL, broken.URL)
+	release := checksumsTestRelease(stale.URL)
+	origins, err := service.DownloadTrustedChecksums(ctx, release)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{good.URL, alsoGood.URL}, origins)
+
+	releaseDir, err := config.ReleaseDir(release)
+	assert.NoError(t, err)
+
+	checksums, err := internal.GetChecksums(filepath.Join(releaseDir, common.ChecksumsTXTFileName), internal.ChecksumAlgorithm(release))
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", checksums["zimaos-99.0.0.raucb"].Sum)
+
+	recorded, err := internal.GetChecksumOrigins(releaseDir)
+	assert.NoError(t, err)
+	assert.Equal(t, origins, recorded)
+
+	// a stale mirror disagrees
+	withMirrors(t, good.URL, stale.URL)
+	_, err = service.DownloadTrustedChecksums(ctx, release)
+	assert.ErrorContains(t, err, "disagree")
+
+	// nothing vouched
+	withMirrors(t, broken.URL)
+	_, err = service.DownloadTrustedChecksums(ctx, release)
+	assert.ErrorIs(t, err, service.ErrChecksumNotVouched)
+
+	// a channel with a single mirror
+	os.RemoveAll(releaseDir)
+	withMirrors(t, good.URL)
+	origins, err = service.DownloadTrustedChecksums(ctx, release)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{good.URL}, origins)
+
+	// a mirror which is not reachable, like raw.githubusercontent.com in some places, is skipped
+	os.RemoveAll(releaseDir)
+	withMirrors(t, good.URL, broken.URL)
+	origins, err = service.DownloadTrustedChecksums(ctx, release)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{good.URL}, origins)
+
+	// unless a quorum is configured
+	quorum := config.ServerInfo.ChecksumQuorum
+	defer func() { config.ServerInfo.ChecksumQuorum = quorum }()
+	config.ServerInfo.ChecksumQuorum = 2
+
+	_, err = service.DownloadTrustedChecksums(ctx, release)
+	assert.ErrorIs(t, err, service.ErrChecksumNotVouched)
+
+	withMirrors(t, good.URL, alsoGood.URL, broken.URL)
+	_, err = service.DownloadTrustedChecksums(ctx, release)
+	assert.NoError(t, err)
+
+	config.ServerInfo.ChecksumQuorum = quorum
+
+	// the designated origin wins over the mirrors, and is trusted alone
+	os.RemoveAll(releaseDir)
+	config.ServerInfo.ChecksumOrigins = []string{good.URL}
+	origins, err = service.DownloadTrustedChecksums(ctx, checksumsTestRelease(stale.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{good.URL}, origins)
+}
+
+func TestChecksumAlgorithms(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	config.ServerInfo.CachePath = t.TempDir()
+
+	sum := sha512.Sum512([]byte("package"))
+	checksum := hex.EncodeToString(sum[:])
+
+	// the origins agree on the checksum, whether the line names the algorithm or the manifest does
+	gnu := newChecksumsServer(checksum + " *zimaos-99.0.0.raucb\n")
+	defer gnu.Close()
+	bsd := newChecksumsServer("SHA512 (zimaos-99.0.0.raucb) = " + checksum + "\n")
+	defer bsd.Close()
+
+	withMirrors(t, gnu.URL, bsd.URL)
+	release := checksumsTestRelease(gnu.URL, bsd.URL)
+	release.ChecksumAlgorithm = lo.ToPtr(codegen.Sha512)
+
+	origins, err := service.DownloadTrustedChecksums(context.Background(), release)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{gnu.URL, bsd.URL}, origins)
+
+	packageFilePath, err := service.RAUCFilePath(release)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(packageFilePath, []byte("package"), 0o600))
+
+	assert.NoError(t, service.NewPeerShare("test").Publish(release))
+
+	// the same line is taken as sha256 without the manifest naming the algorithm
+	release.ChecksumAlgorithm = nil
+	defer func() { config.ServerInfo.ChecksumOrigins = nil }()
+	config.ServerInfo.ChecksumOrigins = []string{gnu.URL}
+	_, err = service.DownloadTrustedChecksums(context.Background(), release)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, service.NewPeerShare("test").Publish(release), internal.ErrChecksumMismatch)
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"go.uber.org/zap"
+)
+
+var ErrNoApplicableDelta = fmt.Errorf("no applicable delta")
+
+// SelectDelta returns the smallest delta of the package which applies to fromVersion and can be applied on this device.
+// a delta without size goes after the ones with size.
+func SelectDelta(pkg codegen.Package, fromVersion string) (codegen.Delta, error) {
+	var selected codegen.Delta
+	var selectedSize int64 = -1
+
+	if pkg.Deltas != nil {
+		for _, delta := range *pkg.Deltas {
+			if NormalizeVersion(delta.FromVersion) != NormalizeVersion(fromVersion) || !internal.DeltaSupported(delta.Type) {
+				continue
+			}
+
+			size := int64(math.MaxInt64)
+			if delta.Size != nil {
+				size = *delta.Size
+			}
+
+			if selectedSize < 0 || size < selectedSize {
+				selected, selectedSize = delta, size
+			}
+		}
+	}
+
+	if selectedSize < 0 {
+		return codegen.Delta{}, fmt.Errorf("%w from %s", ErrNoApplicableDelta, fromVersion)
+	}
+
+	return selected, nil
+}
+
+// DownloadDelta reconstructs the package of the release from the package of the current version, which is kept in its
+// release dir, and a delta. the package is verified against checksums.txt in the release dir, so the checksums have to be
+// downloaded first. returns the package file path and the mirror the delta is downloaded from.
+func DownloadDelta(ctx context.Context, release codegen.Release, sysRoot string) (string, string, error) {
+	currentRelease, err := internal.GetReleaseFromLocal(filepath.Join(sysRoot, CurrentReleaseLocalPath))
+	if err != nil {
+		return "", "", err
+	}
+
+	pkg, ok := internal.SelectPackage(release, internal.CurrentDevice())
+	if !ok {
+		return "", "", fmt.Errorf("package not found for device: %s", internal.CurrentDevice())
+	}
+
+	delta, err := SelectDelta(pkg, currentRelease.Version)
+	if err != nil {
+		return "", "", err
+	}
+
+	basePath, err := RAUCFilePath(*currentRelease)
+	if err != nil {
+		return "", "", err
+	}
+
+	if _, err := os.Stat(basePath); err != nil {
+		return "", "", fmt.Errorf("package of the current version %s is not kept: %w", currentRelease.Version, err)
+	}
+
+	packageFilePath, err := RAUCFilePath(release)
+	if err != nil {
+		return "", "", err
+	}
+
+	checksums, err := GetChecksums(release)
+	if err != nil {
+		return "", "", err
+	}
+
+	checksum, ok := checksums[filepath.Base(packageFilePath)]
+	if !ok {
+		return "", "", fmt.Errorf("package %s is not listed in checksums", filepath.Base(packageFilePath))
+	}
+
+	releaseDir, err := config.ReleaseDir(release)
+	if err != nil {
+		return "", "", err
+	}
+
+	// the package is reconstructed next to the delta, about the size of the one of the current version, which is kept
+	if baseInfo, err := os.Stat(basePath); err == nil {
+		size := baseInfo.Size()
+		if delta.Size != nil {
+			size += *delta.Size
+		}
+		if err := MakeSpace(release, size, currentRelease.Version); err != nil {
+			return "", "", err
+		}
+	}
+
+	for _, mirror := range Mirrors.Rank(release.Mirrors) {
+		deltaURL := internal.ResolveReleaseURL(release, mirror, delta.Path)
+
+		start := time.Now()
+		deltaFilePath, err := internal.Download(ctx, releaseDir, deltaURL, deltaSizeVerifier(delta))
+		if err != nil {
+			// the mirror is not to blame if the download is stopped
+			if ctx.Err() != nil {
+				return "", "", ctx.Err()
+			}
+
+			logger.Error("error while downloading delta - trying next mirror", zap.Error(err), zap.String("delta_url", deltaURL))
+			Mirrors.ReportFailure(mirror, err)
+			continue
+		}
+
+		if info, err := os.Stat(deltaFilePath); err == nil {
+			Mirrors.ReportThroughput(mirror, info.Size(), time.Since(start))
+		}
+
+		err = internal.ApplyDelta(ctx, delta.Type, basePath, deltaFilePath, packageFilePath)
+		os.Remove(deltaFilePath)
+		if err != nil {
+			return "", "", err
+		}
+
+		if err := internal.VerifyChecksum(packageFilePath, checksum); err != nil {
+			os.Remove(packageFilePath)
+			return "", "", fmt.Errorf("package reconstructed from %s delta of %s is broken: %w", delta.Type, delta.FromVersion, err)
+		}
+
+		logger.Info("reconstructed package from delta", zap.String("delta_url", deltaURL), zap.String("from_version", delta.FromVersion), zap.String("package_file_path", packageFilePath))
+		return packageFilePath, mirror, nil
+	}
+
+	return "", "", fmt.Errorf("failed to download the delta from %s from any mirror", delta.FromVersion)
+}
+
+// deltaSizeVerifier verifies a download against the size of the delta, if the manifest gives one
+func deltaSizeVerifier(delta codegen.Delta) internal.DownloadVerifier {
+	return func(partPath string) error {
+		if delta.Size == nil {
+			return nil
+		}
+
+		info, err := os.Stat(partPath)
+		if err != nil {
+			return err
+		}
+
+		if info.Size() != *delta.Size {
+			return fmt.Errorf("size mismatch of delta %s: expected %d, got %d", delta.Path, *delta.Size, info.Size())
+		}
+
+		return nil
+	}
+}
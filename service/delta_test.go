@@ -0,0 +1,274 @@
+package service_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/common"
+	"github.com/IceWhaleTech/CasaOS-Installer/common/fixtures"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/IceWhaleTech/CasaOS-Installer/service"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDeltaTool puts a `bspatch` on PATH which appends the delta to the base
+func fakeDeltaTool(t *testing.T) {
+	binDir := t.TempDir()
+	script := "#!/bin/sh\ncat \"$1\" \"$3\" > \"$2\"\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(binDir, "bspatch"), []byte(script), 0o755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestSelectDelta(t *testing.T) {
+	fakeDeltaTool(t)
+
+	pkg := codegen.Package{
+		Deltas: &[]codegen.Delta{
+			{FromVersion: "v1.0.0", Path: "/big.bsdiff", Type: codegen.Bsdiff, Size: lo.ToPtr(int64(100))},
+			{FromVersion: "v1.0.0", Path: "/unknown-size.bsdiff", Type: codegen.Bsdiff},
+			{FromVersion: "v1.0.0", Path: "/small.bsdiff", Type: codegen.Bsdiff, Size: lo.ToPtr(int64(10))},
+			{FromVersion: "v0.9.0", Path: "/smallest.bsdiff", Type: codegen.Bsdiff, Size: lo.ToPtr(int64(1))},
+			{FromVersion: "v1.0.0", Path: "/no-tool.xdelta", Type: codegen.Xdelta3, Size: lo.ToPtr(int64(1))},
+		},
+	}
+
+	delta, err := service.SelectDelta(pkg, "1.0.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "/small.bsdiff", delta.Path)
+
+	_, err = service.SelectDelta(pkg, "v0.8.0")
+	assert.ErrorIs(t, err, service.ErrNoApplicableDelta)
+}
+
+func TestDownloadDelta(t *testing.T) {
+	logger.LogInitConsoleOnly()
+	fakeDeltaTool(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pkg/delta-v1.0.0.bsdiff":
+			w.Write([]byte("-delta"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	config.ServerInfo.CachePath = t.TempDir()
+
+	sysRoot := t.TempDir()
+	fixtures.SetLocalRelease(sysRoot, "v1.0.0")
+
+	currentRelease, err := internal.GetReleaseFromLocal(filepath.Join(sysRoot, service.CurrentReleaseLocalPath))
+	assert.NoError(t, err)
+
+	// the package of the current version is kept in its release dir
+	basePath, err := service.RAUCFilePath(*currentRelease)
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(basePath), 0o755))
+	assert.NoError(t, os.WriteFile(basePath, []byte("base"), 0o600))
+
+	release := codegen.Release{
+		Version: "v1.1.0",
+		Mirrors: []string{server.URL},
+		Packages: []codegen.Package{
+			{
+				Architecture: codegen.Any,
+				Path:         "/pkg/zimaos-${VERSION}.raucb",
+				Deltas: &[]codegen.Delta{
+					{FromVersion: currentRelease.Version, Path: "/pkg/delta-v1.0.0.bsdiff", Type: codegen.Bsdiff},
+				},
+			},
+		},
+		Checksums: "/checksums.txt",
+	}
+
+	releaseDir, err := config.ReleaseDir(release)
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(releaseDir, 0o755))
+
+	writeChecksum := func(content string) {
+		sum := sha256.Sum256([]byte(content))
+		checksums := hex.EncodeToString(sum[:]) + "  zimaos-v1.1.0.raucb\n"
+		assert.NoError(t, os.WriteFile(filepath.Join(releaseDir, common.ChecksumsTXTFileName), []byte(checksums), 0o600))
+	}
+
+	writeChecksum("base-delta")
+
+	packageFilePath, mirror, err := service.DownloadDelta(context.Background(), release, sysRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL, mirror)
+	assert.Equal(t, filepath.Join(releaseDir, "zimaos-v1.1.0.raucb"), packageFilePath)
+
+	buf, err := os.ReadFile(packageFilePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "base-delta", string(buf))
+	assert.NoFileExists(t, filepath.Join(releaseDir, "delta-v1.0.0.bsdiff"))
+
+	// a package that does not match the checksum is not kept
+	assert.NoError(t, os.Remove(packageFilePath))
+	writeChecksum("something else")
+
+	_, _, err = service.DownloadDelta(context.Background(), release, sysRoot)
+	assert.ErrorContains(t, err, "checksum mismatch")
+	assert.NoFileExists(t, packageFilePath)
+}
+
+func TestDownloadDeltaAfterCleanUp(t *testing.T) {
+	logger.LogInitConsoleOnly()
+	fakeDeltaTool(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pkg/delta-v1.0.0.bsdiff":
+			w.Write([]byte("-delta"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	sysRoot := t.TempDir()
+	config.ServerInfo.CachePath = filepath.Join(sysRoot, "DATA", "rauc")
+
+	// the current version and an older one are installed from the cache
+	writeInstalledRelease := func(version string) string {
+		fixtures.SetLocalRelease(sysRoot, version)
+		installed, err := internal.GetReleaseFromLocal(filepath.Join(sysRoot, service.CurrentReleaseLocalPath))
+		assert.NoError(t, err)
+
+		packageFilePath, err := service.RAUCFilePath(*installed)
+		assert.NoError(t, err)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(packageFilePath), 0o755))
+		assert.NoError(t, os.WriteFile(packageFilePath, []byte("base"), 0o600))
+		assert.NoError(t, internal.WriteReleaseToLocal(installed, filepath.Join(filepath.Dir(packageFilePath), common.ReleaseYAMLFileName)))
+		return packageFilePath
+	}
+
+	oldPackageFilePath := writeInstalledRelease("v0.9.0")
+	basePath := writeInstalledRelease("v1.0.0")
+
+	statusService := service.NewStatusService(&service.TestService{}, sysRoot)
+	assert.NoError(t, statusService.CleanUpOldRelease(sysRoot))
+
+	// the package of the older version is removed, the one of the current version is kept as the base
+	assert.NoFileExists(t, oldPackageFilePath)
+	assert.FileExists(t, basePath)
+	assert.FileExists(t, filepath.Join(filepath.Dir(basePath), common.ReleaseYAMLFileName))
+
+	release := codegen.Release{
+		Version: "v1.1.0",
+		Mirrors: []string{server.URL},
+		Packages: []codegen.Package{
+			{
+				Architecture: codegen.Any,
+				Path:         "/pkg/zimaos-${VERSION}.raucb",
+				Deltas: &[]codegen.Delta{
+					{FromVersion: "v1.0.0", Path: "/pkg/delta-v1.0.0.bsdiff", Type: codegen.Bsdiff},
+				},
+			},
+		},
+		Checksums: "/checksums.txt",
+	}
+
+	releaseDir, err := config.ReleaseDir(release)
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(releaseDir, 0o755))
+
+	sum := sha256.Sum256([]byte("base-delta"))
+	checksums := hex.EncodeToString(sum[:]) + "  zimaos-v1.1.0.raucb\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(releaseDir, common.ChecksumsTXTFileName), []byte(checksums), 0o600))
+
+	packageFilePath, _, err := service.DownloadDelta(context.Background(), release, sysRoot)
+	assert.NoError(t, err)
+
+	buf, err := os.ReadFile(packageFilePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "base-delta", string(buf))
+}
+
+func TestStoppedDownloadIsNotMirrorFailure(t *testing.T) {
+	logger.LogInitConsoleOnly()
+	fakeDeltaTool(t)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	deltaRequested := make(chan struct{})
+	var packageRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/checksums.txt":
+			sum := sha256.Sum256([]byte("base-delta"))
+			w.Write([]byte(hex.EncodeToString(sum[:]) + "  zimaos-v1.1.0.raucb\n"))
+		case "/pkg/delta-v1.0.0.bsdiff":
+			// the user pauses while the delta is downloaded
+			close(deltaRequested)
+			<-r.Context().Done()
+		default:
+			packageRequests.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	origin := httptest.NewServer(server.Config.Handler)
+	defer origin.Close()
+
+	config.ServerInfo.CachePath = t.TempDir()
+	config.SysRoot = t.TempDir()
+	defer func() { config.SysRoot = "/" }()
+
+	checksumOrigins := config.ServerInfo.ChecksumOrigins
+	defer func() { config.ServerInfo.ChecksumOrigins = checksumOrigins }()
+	config.ServerInfo.ChecksumOrigins = []string{server.URL, origin.URL}
+
+	fixtures.SetLocalRelease(config.SysRoot, "v1.0.0")
+	currentRelease, err := internal.GetReleaseFromLocal(filepath.Join(config.SysRoot, service.CurrentReleaseLocalPath))
+	assert.NoError(t, err)
+
+	basePath, err := service.RAUCFilePath(*currentRelease)
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(basePath), 0o755))
+	assert.NoError(t, os.WriteFile(basePath, []byte("base"), 0o600))
+
+	release := codegen.Release{
+		Version: "v1.1.0",
+		Mirrors: []string{server.URL},
+		Packages: []codegen.Package{
+			{
+				Architecture: codegen.Any,
+				Path:         "/pkg/zimaos-${VERSION}.raucb",
+				Deltas: &[]codegen.Delta{
+					{FromVersion: currentRelease.Version, Path: "/pkg/delta-v1.0.0.bsdiff", Type: codegen.Bsdiff},
+				},
+			},
+		},
+		Checksums: "/checksums.txt",
+	}
+
+	go func() {
+		<-deltaRequested
+		cancel(service.ErrDownloadPaused)
+	}()
+
+	_, err = service.DownloadRelease(ctx, release, false)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// the full package is not tried with the download stopped, and the mirror is not to blame
+	assert.Zero(t, packageRequests.Load())
+
+	stat, _ := lo.Find(service.Mirrors.Stats(), func(stat codegen.MirrorStat) bool { return stat.Url == server.URL })
+	assert.Zero(t, stat.ConsecutiveFailures)
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/IceWhaleTech/CasaOS-Installer/types"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrDownloadPaused   = fmt.Errorf("download is paused")
+	ErrDownloadCanceled = fmt.Errorf("download is canceled")
+	ErrNoDownload       = fmt.Errorf("no download in progress")
+	ErrNoPausedDownload = fmt.Errorf("no download is paused")
+)
+
+// downloadOperation is a download in progress, which can be paused or canceled by the user.
+type downloadOperation struct {
+	release codegen.Release
+	cancel  context.CancelCauseFunc
+
+	// what started the download, it is resumed the same way
+	trigger types.TriggerType
+
+	// closed when the download returns with err
+	done chan struct{}
+	err  error
+}
+
+// IsDownloadStopped returns true if the download is paused or canceled by the user, rather than failed.
+func IsDownloadStopped(err error) bool {
+	return errors.Is(err, ErrDownloadPaused) || errors.Is(err, ErrDownloadCanceled)
+}
+
+// startDownload returns the context to run the download of the release with, until finishDownload.
+func (r *StatusService) startDownload(ctx context.Context, release codegen.Release) (context.Context, *downloadOperation) {
+	trigger, _ := ctx.Value(types.Trigger).(types.TriggerType)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	operation := &downloadOperation{
+		release: release,
+		cancel:  cancel,
+		trigger: trigger,
+		done:    make(chan struct{}),
+	}
+
+	r.lock.Lock()
+	r.download = operation
+	r.pausedDownload = nil
+	r.lock.Unlock()
+
+	return ctx, operation
+}
+
+func (r *StatusService) finishDownload(operation *downloadOperation, err error) {
+	r.lock.Lock()
+	if r.download == operation {
+		r.download = nil
+	}
+	r.lock.Unlock()
+
+	operation.err = err
+	operation.cancel(nil)
+	close(operation.done)
+}
+
+// stopDownload stops the download in progress with the cause, and waits for it to return. returns nil if there is
+// no download in progress, or it is done before it could be stopped.
+func (r *StatusService) stopDownload(cause error) *downloadOperation {
+	r.lock.Lock()
+	operation := r.download
+	r.lock.Unlock()
+
+	if operation == nil {
+		return nil
+	}
+
+	operation.cancel(cause)
+	<-operation.done
+
+	if !IsDownloadStopped(operation.err) {
+		return nil
+	}
+
+	return operation
+}
+
+// PauseDownload stops the download in progress, and keeps what is downloaded to be resumed by ResumeDownload.
+func (r *StatusService) PauseDownload() error {
+	operation := r.stopDownload(ErrDownloadPaused)
+	if operation == nil {
+		return ErrNoDownload
+	}
+
+	r.lock.Lock()
+	r.pausedDownload = operation
+	r.lock.Unlock()
+
+	logger.Info("download is paused by the user", zap.String("release version", operation.release.Version))
+	r.UpdateStatusWithMessage(DownloadPaused, "paused by the user")
+	return nil
+}
+
+// ResumeDownload downloads the release paused by PauseDownload in background, from where it is paused. it is resumed
+// as it is started, so a download for install goes on to install the release.
+func (r *StatusService) ResumeDownload() error {
+	r.lock.Lock()
+	operation := r.pausedDownload
+	r.pausedDownload = nil
+	r.lock.Unlock()
+
+	if operation == nil {
+		return ErrNoPausedDownload
+	}
+
+	logger.Info("download is resumed by the user", zap.String("release version", operation.release.Version))
+
+	go func() {
+		ctx := context.WithValue(context.Background(), types.Trigger, operation.trigger)
+		releasePath, err := r.downloadRelease(ctx, operation.release, false)
+		if err != nil {
+			logger.Error("error when trying to resume download", zap.Error(err), zap.String("release version", operation.release.Version))
+			return
+		}
+
+		if operation.trigger == types.INSTALL {
+			if err := r.InstallDownloadedRelease(releasePath, operation.release); err != nil {
+				logger.Error("error when trying to install resumed download", zap.Error(err), zap.String("release version", operation.release.Version))
+			}
+		}
+	}()
+
+	return nil
+}
+
+// CancelDownload stops the download in progress or paused, and removes what is partially downloaded.
+func (r *StatusService) CancelDownload() error {
+	operation := r.stopDownload(ErrDownloadCanceled)
+	if operation == nil {
+		r.lock.Lock()
+		operation = r.pausedDownload
+		r.pausedDownload = nil
+		r.lock.Unlock()
+	}
+
+	if operation == nil {
+		return ErrNoDownload
+	}
+
+	if err := CleanPartialDownloads(operation.release); err != nil {
+		logger.Error("error when trying to remove partial downloads", zap.Error(err), zap.String("release version", operation.release.Version))
+	}
+
+	logger.Info("download is canceled by the user", zap.String("release version", operation.release.Version))
+	r.UpdateStatusWithMessage(DownloadCanceled, ErrDownloadCanceled.Error())
+	return nil
+}
+
+// CleanPartialDownloads removes what is partially downloaded for the release, see internal.PartialDownloadSuffix
+func CleanPartialDownloads(release codegen.Release) error {
+	releaseDir, err := config.ReleaseDir(release)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(releaseDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if !internal.IsPartialDownload(entry.Name()) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(releaseDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
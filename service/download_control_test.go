@@ -0,0 +1,153 @@
+package service_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/IceWhaleTech/CasaOS-Installer/service"
+	"github.com/IceWhaleTech/CasaOS-Installer/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingService downloads until the download is stopped
+type blockingService struct {
+	*service.TestService
+}
+
+func (s *blockingService) DownloadRelease(ctx context.Context, release codegen.Release, force bool) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func waitForStatus(t *testing.T, statusService *service.StatusService, status codegen.StatusStatus) {
+	assert.Eventually(t, func() bool {
+		value, _ := statusService.GetStatus()
+		return value.Status == status
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPauseResumeCancelDownload(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	config.ServerInfo.CachePath = t.TempDir()
+	sysRoot := t.TempDir()
+
+	statusService := service.NewStatusService(&blockingService{TestService: &service.TestService{
+		InstallRAUCHandler: service.AlwaysSuccessInstallHandler,
+		DownloadStatusLock: sync.RWMutex{},
+	}}, sysRoot)
+
+	assert.ErrorIs(t, statusService.PauseDownload(), service.ErrNoDownload)
+	assert.ErrorIs(t, statusService.ResumeDownload(), service.ErrNoPausedDownload)
+
+	release := codegen.Release{Version: "v1.1.0"}
+	ctx := context.WithValue(context.Background(), types.Trigger, types.CRON_JOB)
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := statusService.DownloadRelease(ctx, release, false)
+		result <- err
+	}()
+	waitForStatus(t, statusService, codegen.Downloading)
+
+	// paused, and the download returns without an error status
+	assert.NoError(t, statusService.PauseDownload())
+	assert.ErrorIs(t, <-result, service.ErrDownloadPaused)
+
+	status, message := statusService.GetStatus()
+	assert.Equal(t, codegen.DownloadPaused, status.Status)
+	assert.Equal(t, "paused by the user", message)
+
+	// a paused download is not started over by the cron job
+	_, err := statusService.DownloadRelease(ctx, release, false)
+	assert.Error(t, err)
+
+	assert.NoError(t, statusService.ResumeDownload())
+	waitForStatus(t, statusService, codegen.Downloading)
+
+	// canceled, and what is partially downloaded is removed
+	releaseDir, err := config.ReleaseDir(release)
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(releaseDir, 0o755))
+	partPath := filepath.Join(releaseDir, "zimaos.raucb.part")
+	assert.NoError(t, os.WriteFile(partPath, []byte("partial"), 0o600))
+
+	assert.NoError(t, statusService.CancelDownload())
+	assert.NoFileExists(t, partPath)
+
+	status, message = statusService.GetStatus()
+	assert.Equal(t, codegen.Idle, status.Status)
+	assert.Equal(t, service.ErrDownloadCanceled.Error(), message)
+
+	assert.ErrorIs(t, statusService.CancelDownload(), service.ErrNoDownload)
+}
+
+// pausableService downloads until the download is stopped the first time, and right away after
+type pausableService struct {
+	*service.TestService
+
+	started atomic.Bool
+}
+
+func (s *pausableService) DownloadRelease(ctx context.Context, release codegen.Release, force bool) (string, error) {
+	if s.started.CompareAndSwap(false, true) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return "release.yaml", nil
+}
+
+func TestPauseResumeInstallDownload(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	config.ServerInfo.CachePath = t.TempDir()
+	sysRoot := t.TempDir()
+
+	installStepDelay := service.InstallStepDelay
+	t.Cleanup(func() { service.InstallStepDelay = installStepDelay })
+	service.InstallStepDelay = 0
+
+	installed := make(chan struct{}, 1)
+	statusService := service.NewStatusService(&pausableService{TestService: &service.TestService{
+		InstallRAUCHandler: func(string) error {
+			installed <- struct{}{}
+			return nil
+		},
+		DownloadStatusLock: sync.RWMutex{},
+	}}, sysRoot)
+
+	release := codegen.Release{Version: "v1.1.0"}
+	ctx := context.WithValue(context.Background(), types.Trigger, types.INSTALL)
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := statusService.DownloadRelease(ctx, release, false)
+		result <- err
+	}()
+	waitForStatus(t, statusService, codegen.Installing)
+
+	assert.NoError(t, statusService.PauseDownload())
+	assert.ErrorIs(t, <-result, service.ErrDownloadPaused)
+
+	// the download for install goes on to install, rather than being ready to update
+	assert.NoError(t, statusService.ResumeDownload())
+
+	select {
+	case <-installed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("resumed download is not installed")
+	}
+
+	assert.Eventually(t, func() bool {
+		_, message := statusService.GetStatus()
+		return message == types.RESTARTING
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,65 @@
+package service_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/IceWhaleTech/CasaOS-Installer/service"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestLocalMirror(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	config.ServerInfo.CachePath = t.TempDir()
+	config.SysRoot = t.TempDir()
+	defer func() { config.SysRoot = "/" }()
+
+	// the online mirror is not reachable from the air-gapped device
+	online := httptest.NewServer(http.NotFoundHandler())
+	defer online.Close()
+
+	// the manifest is copied to the share as is, listing the online mirrors only
+	share := t.TempDir()
+	release := checksumsTestRelease(online.URL + "/")
+
+	buf, err := yaml.Marshal(release)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(share, "rauc.txt"), buf, 0o600))
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(share, "release"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(share, "release", "zimaos-99.0.0.raucb"), []byte("package"), 0o600))
+
+	sum := sha256.Sum256([]byte("package"))
+	checksums := hex.EncodeToString(sum[:]) + "  zimaos-99.0.0.raucb\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(share, "release", "checksums.txt"), []byte(checksums), 0o600))
+
+	mirror := "file://" + share + "/"
+
+	// the share is the only mirror, so it vouches for the checksums alone
+	withMirrors(t, mirror)
+
+	fetched, err := service.FetchRelease(context.Background(), "rauc", service.HyperFileTagReleaseURL)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{mirror, online.URL + "/"}, fetched.Mirrors)
+
+	releaseFilePath, err := service.DownloadRelease(context.Background(), *fetched, false)
+	assert.NoError(t, err)
+
+	packageFilePath, err := service.RAUCFilePath(*fetched)
+	assert.NoError(t, err)
+	assert.FileExists(t, releaseFilePath)
+
+	buf, err = os.ReadFile(packageFilePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "package", string(buf))
+}
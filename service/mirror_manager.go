@@ -0,0 +1,320 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+)
+
+const (
+	MirrorStatsFileName = "mirrors.json"
+
+	// the size used to weigh throughput against latency when ranking
+	mirrorRankingSize = 100 * 1024 * 1024
+)
+
+// Mirrors keeps the statistics of all mirrors, it is replaced by a persistent one on launch.
+var Mirrors = NewMirrorManager("")
+
+// MirrorStatsFlushDelay is the wait before the statistics are written after a report, so that the many reports of a
+// download are written at once.
+var MirrorStatsFlushDelay = 5 * time.Second
+
+// MirrorManager ranks mirrors by latency, throughput and failures, and keeps the statistics on disk. a mirror which
+// keeps failing is skipped for a while by its circuit breaker, see config.RetryInfo.
+type MirrorManager struct {
+	statsPath string
+	stats     map[string]*codegen.MirrorStat
+	lock      sync.RWMutex
+
+	// the statistics are changed since they are written, and a flush is scheduled. see Flush
+	dirty bool
+
+	// held while writing the statistics, so that an older write does not overwrite a newer one
+	flushLock sync.Mutex
+}
+
+func MirrorStatsPath() string {
+	return filepath.Join(config.ServerInfo.CachePath, MirrorStatsFileName)
+}
+
+// NewMirrorManager loads the statistics from statsPath. the statistics are kept in memory only if statsPath is empty.
+func NewMirrorManager(statsPath string) *MirrorManager {
+	m := &MirrorManager{
+		statsPath: statsPath,
+		stats:     map[string]*codegen.MirrorStat{},
+	}
+
+	if statsPath == "" {
+		return m
+	}
+
+	buf, err := os.ReadFile(statsPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("error when trying to load mirror stats", zap.Error(err), zap.String("path", statsPath))
+		}
+		return m
+	}
+
+	if err := json.Unmarshal(buf, &m.stats); err != nil {
+		logger.Error("error when trying to parse mirror stats - starting over", zap.Error(err), zap.String("path", statsPath))
+		m.stats = map[string]*codegen.MirrorStat{}
+	}
+
+	return m
+}
+
+// should be called with lock held
+func (m *MirrorManager) stat(mirror string) *codegen.MirrorStat {
+	stat, ok := m.stats[mirror]
+	if !ok {
+		stat = &codegen.MirrorStat{Url: mirror}
+		m.stats[mirror] = stat
+	}
+	return stat
+}
+
+// should be called with lock held. the statistics are written by Flush later, rather than on the download path.
+func (m *MirrorManager) save() {
+	if m.statsPath == "" || m.dirty {
+		return
+	}
+
+	m.dirty = true
+	time.AfterFunc(MirrorStatsFlushDelay, m.Flush)
+}
+
+// Flush writes the statistics to disk if they are changed since they are written. it is done MirrorStatsFlushDelay
+// after a report, and should be done on shutdown.
+func (m *MirrorManager) Flush() {
+	m.flushLock.Lock()
+	defer m.flushLock.Unlock()
+
+	m.lock.Lock()
+	if !m.dirty {
+		m.lock.Unlock()
+		return
+	}
+	m.dirty = false
+	buf, err := json.MarshalIndent(m.stats, "", "  ")
+	m.lock.Unlock()
+
+	if err != nil {
+		logger.Error("error when trying to marshal mirror stats", zap.Error(err))
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.statsPath), 0o755); err != nil {
+		logger.Error("error when trying to create dir for mirror stats", zap.Error(err))
+		return
+	}
+
+	if err := os.WriteFile(m.statsPath, buf, 0o600); err != nil {
+		logger.Error("error when trying to save mirror stats", zap.Error(err), zap.String("path", m.statsPath))
+	}
+}
+
+func (m *MirrorManager) ReportSuccess(mirror string, latency time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	stat := m.stat(mirror)
+	stat.Successes++
+	stat.ConsecutiveFailures = 0
+	stat.LatencyMs = latency.Milliseconds()
+	stat.LastSuccessAt = lo.ToPtr(time.Now())
+
+	if stat.BreakerOpenUntil != nil {
+		logger.Info("mirror is back - closing its circuit breaker", zap.String("mirror", mirror))
+		stat.BreakerOpenUntil = nil
+	}
+
+	m.save()
+}
+
+func (m *MirrorManager) ReportThroughput(mirror string, size int64, elapsed time.Duration) {
+	if size <= 0 || elapsed <= 0 {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	stat := m.stat(mirror)
+	stat.Throughput = int64(float64(size) / elapsed.Seconds())
+
+	m.save()
+}
+
+func (m *MirrorManager) ReportFailure(mirror string, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	stat := m.stat(mirror)
+	stat.Failures++
+	stat.ConsecutiveFailures++
+	stat.LastFailureAt = lo.ToPtr(time.Now())
+	if err != nil {
+		stat.LastError = lo.ToPtr(err.Error())
+	}
+
+	// a half open mirror is opened again by a single failure, as the failures are still counted
+	threshold := config.RetryInfo.BreakerThreshold
+	if threshold > 0 && stat.ConsecutiveFailures >= threshold && breakerState(stat, time.Now()) != codegen.Open {
+		stat.BreakerOpenUntil = lo.ToPtr(time.Now().Add(config.RetryInfo.BreakerCooldown))
+		logger.Info("mirror keeps failing - opening its circuit breaker", zap.String("mirror", mirror), zap.Int("consecutive_failures", stat.ConsecutiveFailures), zap.Time("until", *stat.BreakerOpenUntil))
+	}
+
+	m.save()
+}
+
+// breakerState returns the state of the circuit breaker of the mirror at the time.
+func breakerState(stat *codegen.MirrorStat, now time.Time) codegen.MirrorStatBreaker {
+	switch {
+	case stat.BreakerOpenUntil == nil:
+		return codegen.Closed
+	case now.Before(*stat.BreakerOpenUntil):
+		return codegen.Open
+	default:
+		return codegen.HalfOpen
+	}
+}
+
+// should be called with lock held
+func (m *MirrorManager) isOpen(mirror string, now time.Time) bool {
+	stat, ok := m.stats[mirror]
+	return ok && breakerState(stat, now) == codegen.Open
+}
+
+// should be called with lock held. mirrors with lower rank are better.
+func (m *MirrorManager) rank(mirror string) (group int, score float64) {
+	stat, ok := m.stats[mirror]
+	if !ok {
+		// unknown mirrors go after the good ones, but before the failing ones
+		return 1, 0
+	}
+
+	if stat.ConsecutiveFailures > 0 {
+		return 1 + stat.ConsecutiveFailures, 0
+	}
+
+	// estimated seconds to fetch a release
+	score = float64(stat.LatencyMs) / 1000
+	if stat.Throughput > 0 {
+		score += float64(mirrorRankingSize) / float64(stat.Throughput)
+	}
+	return 0, score
+}
+
+// Rank returns mirrors ordered from the best to the worst, without the ones whose circuit breaker is open unless all
+// of them are. mirrors without statistics keep their order.
+func (m *MirrorManager) Rank(mirrors []string) []string {
+	ranked := m.rankAll(mirrors)
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	now := time.Now()
+	available := lo.Filter(ranked, func(mirror string, _ int) bool {
+		return !m.isOpen(mirror, now)
+	})
+
+	if len(available) == 0 {
+		return ranked
+	}
+
+	if skipped := len(ranked) - len(available); skipped > 0 {
+		logger.Info("skipping mirrors with open circuit breaker", zap.Strings("mirrors", lo.Without(ranked, available...)))
+	}
+
+	return available
+}
+
+// rankAll returns mirrors ordered from the best to the worst, including the ones whose circuit breaker is open.
+func (m *MirrorManager) rankAll(mirrors []string) []string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	ranked := lo.Uniq(mirrors)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		groupI, scoreI := m.rank(ranked[i])
+		groupJ, scoreJ := m.rank(ranked[j])
+		if groupI != groupJ {
+			return groupI < groupJ
+		}
+		return scoreI < scoreJ
+	})
+
+	return ranked
+}
+
+// Stats returns the statistics of the mirrors in the current channel and all known mirrors, ordered by ranking.
+func (m *MirrorManager) Stats() []codegen.MirrorStat {
+	m.lock.RLock()
+	mirrors := append([]string{}, config.ServerInfo.Mirrors...)
+	mirrors = append(mirrors, lo.Keys(m.stats)...)
+	m.lock.RUnlock()
+
+	now := time.Now()
+	return lo.Map(m.rankAll(mirrors), func(mirror string, _ int) codegen.MirrorStat {
+		m.lock.RLock()
+		defer m.lock.RUnlock()
+
+		stat := codegen.MirrorStat{Url: mirror}
+		if known, ok := m.stats[mirror]; ok {
+			stat = *known
+		}
+		stat.Breaker = lo.ToPtr(breakerState(&stat, now))
+		return stat
+	})
+}
+
+// Probe requests the release file of tag from every mirror of the current channel, and ranks them by the result. the
+// mirrors with open circuit breaker are probed too, so that they are closed as soon as they are back.
+func (m *MirrorManager) Probe(ctx context.Context, tag string, constructReleaseFileURLFunc ConstructReleaseFileURLFunc) []string {
+	var wg sync.WaitGroup
+	for _, mirror := range lo.Uniq(config.ServerInfo.Mirrors) {
+		wg.Add(1)
+		go func(mirror string) {
+			defer wg.Done()
+
+			url := constructReleaseFileURLFunc(tag, mirror)
+
+			start := time.Now()
+			resp, err := internal.Probe(ctx, url)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				m.ReportFailure(mirror, err)
+				return
+			}
+
+			if resp.StatusCode != http.StatusOK {
+				m.ReportFailure(mirror, fmt.Errorf("failed to probe %s - %s", url, resp.Status))
+				return
+			}
+
+			m.ReportSuccess(mirror, time.Since(start))
+		}(mirror)
+	}
+	wg.Wait()
+
+	ranked := m.Rank(config.ServerInfo.Mirrors)
+	logger.Info("mirrors ranked", zap.Strings("mirrors", ranked))
+	return ranked
+}
@@ -0,0 +1,135 @@
+package service_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/IceWhaleTech/CasaOS-Installer/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorManagerRank(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	m := service.NewMirrorManager("")
+
+	mirrors := []string{"http://a/", "http://b/", "http://c/", "http://d/"}
+
+	// without statistics the order is kept
+	assert.Equal(t, mirrors, m.Rank(mirrors))
+
+	m.ReportFailure("http://a/", fmt.Errorf("connection refused"))
+	m.ReportSuccess("http://c/", 200*time.Millisecond)
+	m.ReportSuccess("http://d/", 50*time.Millisecond)
+
+	assert.Equal(t, []string{"http://d/", "http://c/", "http://b/", "http://a/"}, m.Rank(mirrors))
+
+	// a slow download outweighs a quick response
+	m.ReportThroughput("http://d/", 1024*1024, 10*time.Second)
+	m.ReportThroughput("http://c/", 100*1024*1024, 10*time.Second)
+	assert.Equal(t, []string{"http://c/", "http://d/", "http://b/", "http://a/"}, m.Rank(mirrors))
+
+	// a mirror recovers once it succeeds again
+	m.ReportSuccess("http://a/", 10*time.Millisecond)
+	assert.Equal(t, "http://a/", m.Rank(mirrors)[0])
+}
+
+func TestMirrorManagerPersistence(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	statsPath := filepath.Join(t.TempDir(), service.MirrorStatsFileName)
+
+	m := service.NewMirrorManager(statsPath)
+	m.ReportFailure("http://a/", fmt.Errorf("connection refused"))
+	m.ReportSuccess("http://b/", 100*time.Millisecond)
+
+	// the reports are not written on the download path
+	assert.NoFileExists(t, statsPath)
+	m.Flush()
+
+	reloaded := service.NewMirrorManager(statsPath)
+	assert.Equal(t, []string{"http://b/", "http://a/"}, reloaded.Rank([]string{"http://a/", "http://b/"}))
+
+	stats := reloaded.Stats()
+	for _, stat := range stats {
+		if stat.Url == "http://a/" {
+			assert.Equal(t, 1, stat.ConsecutiveFailures)
+			assert.Equal(t, "connection refused", *stat.LastError)
+		}
+	}
+}
+
+func TestMirrorManagerFlush(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	flushDelay := service.MirrorStatsFlushDelay
+	t.Cleanup(func() { service.MirrorStatsFlushDelay = flushDelay })
+	service.MirrorStatsFlushDelay = 50 * time.Millisecond
+
+	statsPath := filepath.Join(t.TempDir(), service.MirrorStatsFileName)
+
+	// the reports are written at once, a while after the first one
+	m := service.NewMirrorManager(statsPath)
+	m.ReportSuccess("http://a/", 100*time.Millisecond)
+	m.ReportThroughput("http://a/", 1024*1024, time.Second)
+	assert.NoFileExists(t, statsPath)
+
+	assert.Eventually(t, func() bool {
+		stats := service.NewMirrorManager(statsPath).Stats()
+		return len(stats) > 0 && stats[0].Throughput == 1024*1024
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestMirrorManagerBreaker(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	retryInfo := *config.RetryInfo
+	t.Cleanup(func() { *config.RetryInfo = retryInfo })
+	config.RetryInfo.BreakerThreshold = 2
+	config.RetryInfo.BreakerCooldown = 100 * time.Millisecond
+
+	m := service.NewMirrorManager("")
+	mirrors := []string{"http://a/", "http://b/"}
+
+	breaker := func(mirror string) codegen.MirrorStatBreaker {
+		for _, stat := range m.Stats() {
+			if stat.Url == mirror {
+				return *stat.Breaker
+			}
+		}
+		return ""
+	}
+
+	m.ReportFailure("http://a/", fmt.Errorf("connection refused"))
+	assert.Equal(t, codegen.Closed, breaker("http://a/"))
+	assert.Equal(t, []string{"http://b/", "http://a/"}, m.Rank(mirrors))
+
+	// open after the threshold, so the mirror is skipped
+	m.ReportFailure("http://a/", fmt.Errorf("connection refused"))
+	assert.Equal(t, codegen.Open, breaker("http://a/"))
+	assert.Equal(t, []string{"http://b/"}, m.Rank(mirrors))
+
+	// unless every mirror is open
+	m.ReportFailure("http://b/", fmt.Errorf("connection refused"))
+	m.ReportFailure("http://b/", fmt.Errorf("connection refused"))
+	assert.Equal(t, []string{"http://a/", "http://b/"}, m.Rank(mirrors))
+
+	// half open after the cooldown, so the mirror is tried again
+	time.Sleep(config.RetryInfo.BreakerCooldown)
+	assert.Equal(t, codegen.HalfOpen, breaker("http://a/"))
+	assert.Len(t, m.Rank(mirrors), 2)
+
+	// a failure while half open opens it again
+	m.ReportFailure("http://a/", fmt.Errorf("connection refused"))
+	assert.Equal(t, codegen.Open, breaker("http://a/"))
+
+	// and a success closes it
+	m.ReportSuccess("http://b/", 10*time.Millisecond)
+	assert.Equal(t, codegen.Closed, breaker("http://b/"))
+	assert.Equal(t, []string{"http://b/"}, m.Rank(mirrors))
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/common"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/Masterminds/semver/v3"
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+)
+
+// ServeMirror serves the shared releases in the layout of a mirror, so that the address of the share can be one of
+// the mirrors in installer.conf of other devices on the same channel:
+//
+//   - `GET /<tag>.txt` is the newest shared release, rewritten to be downloaded from the share, see MirrorRelease
+//   - `GET /<tag>-revoked.txt` is the revocation list of the channel kept on this device
+//   - checksums.txt the release is verified against, at the path of the upstream manifest, so that the share can be
+//     the only mirror and vouch for it like any other mirror
+//
+// the tag is the channel of this device, other channels are not found. returns false if the request is not for the
+// mirror.
+func (s *PeerShare) ServeMirror(w http.ResponseWriter, r *http.Request) bool {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	tag := GetReleaseBranch(config.SysRoot)
+	mirror := "http://" + r.Host + "/"
+
+	switch {
+	case name == tag+"-revoked.txt":
+		if _, err := os.Stat(RevocationListPath()); err != nil {
+			http.NotFound(w, r)
+			return true
+		}
+		http.ServeFile(w, r, RevocationListPath())
+		return true
+
+	case name == tag+".txt":
+		release, ok := s.newestRelease()
+		if !ok {
+			http.NotFound(w, r)
+			return true
+		}
+
+		buf, err := yaml.Marshal(MirrorRelease(release.release, release.packageFilePath, mirror))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return true
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(buf)
+		return true
+
+	case strings.HasSuffix(name, ".txt") && !strings.Contains(name, "/"):
+		// the release or the revocation list of another channel
+		http.NotFound(w, r)
+		return true
+	}
+
+	if release, ok := s.checksumsRelease(mirror, r.URL.Path); ok {
+		s.serveFile(w, r, release.release.Version, filepath.Join(filepath.Dir(release.packageFilePath), common.ChecksumsTXTFileName))
+		return true
+	}
+
+	return false
+}
+
+// checksumsRelease returns the shared release which has its checksums.txt at urlPath of the mirror. the newest one
+// is preferred, which the manifest is of, if releases share the path.
+func (s *PeerShare) checksumsRelease(mirror string, urlPath string) (sharedRelease, bool) {
+	if newest, ok := s.newestRelease(); ok && checksumsPath(newest.release, mirror) == urlPath {
+		return newest, true
+	}
+
+	for _, version := range s.Versions() {
+		if release, ok := s.sharedRelease(version); ok && checksumsPath(release.release, mirror) == urlPath {
+			return release, true
+		}
+	}
+
+	return sharedRelease{}, false
+}
+
+// checksumsPath returns the path of checksums.txt of the release on the mirror.
+func checksumsPath(release codegen.Release, mirror string) string {
+	checksumsURL, err := url.Parse(internal.GetChecksumsURL(release, mirror))
+	if err != nil {
+		return ""
+	}
+	return checksumsURL.Path
+}
+
+// newestRelease returns the shared release of the newest version.
+func (s *PeerShare) newestRelease() (sharedRelease, bool) {
+	var newest sharedRelease
+	var newestVersion *semver.Version
+
+	for _, version := range s.Versions() {
+		release, ok := s.sharedRelease(version)
+		if !ok {
+			continue
+		}
+
+		parsed, err := semver.NewVersion(NormalizeVersion(version))
+		if err != nil {
+			continue
+		}
+
+		if newestVersion == nil || parsed.GreaterThan(newestVersion) {
+			newest, newestVersion = release, parsed
+		}
+	}
+
+	return newest, newestVersion != nil
+}
+
+// MirrorRelease returns the release to be served by the mirror, which points at the package of the release in the
+// cache. checksums.txt is left at its upstream path, which the mirror serves too. only the packages which are the
+// cached one are left, and deltas are left out.
+//
+// the manifest is not the one signed any more, so devices with a keyring do not take it from the mirror.
+func MirrorRelease(release codegen.Release, packageFilePath string, mirror string) codegen.Release {
+	filename := filepath.Base(packageFilePath)
+	releasePath := "/releases/" + release.Version + "/"
+
+	mirrored := release
+	mirrored.Mirrors = []string{mirror}
+	mirrored.Packages = lo.FilterMap(release.Packages, func(pkg codegen.Package, _ int) (codegen.Package, bool) {
+		if path.Base(internal.ResolveReleaseURL(release, mirror, pkg.Path)) != filename {
+			return pkg, false
+		}
+
+		pkg.Path = releasePath + filename
+		pkg.Deltas = nil
+		return pkg, true
+	})
+
+	return mirrored
+}
@@ -0,0 +1,133 @@
+package service_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/IceWhaleTech/CasaOS-Installer/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorRelease(t *testing.T) {
+	release := checksumsTestRelease("https://mirror.example/")
+	release.Packages = append(release.Packages, codegen.Package{Path: "/release/other.raucb", Architecture: codegen.Amd64})
+
+	mirrored := service.MirrorRelease(release, "/cache/releases/v99.0.0/zimaos-99.0.0.raucb", "http://192.168.1.2:8339/")
+
+	assert.Equal(t, []string{"http://192.168.1.2:8339/"}, mirrored.Mirrors)
+	assert.Equal(t, release.Checksums, mirrored.Checksums)
+	assert.Len(t, mirrored.Packages, 3)
+	for _, pkg := range mirrored.Packages {
+		assert.Equal(t, "/releases/v99.0.0/zimaos-99.0.0.raucb", pkg.Path)
+	}
+
+	// the release is not changed
+	assert.Equal(t, []string{"https://mirror.example/"}, release.Mirrors)
+	assert.Len(t, release.Packages, 4)
+}
+
+func TestServeMirror(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	config.ServerInfo.CachePath = t.TempDir()
+
+	older := checksumsTestRelease("https://mirror.example/")
+	older.Version = "v98.0.0"
+	writeCachedRelease(t, older, "older package", true)
+
+	release := checksumsTestRelease("https://mirror.example/")
+	writeCachedRelease(t, release, "package", true)
+
+	share := service.NewPeerShare("mirror")
+	assert.NoError(t, share.Publish(older))
+	assert.NoError(t, share.Publish(release))
+
+	server := httptest.NewServer(share)
+	defer server.Close()
+
+	// not served as a mirror unless it is enabled
+	response, err := http.Get(server.URL + "/rauc.txt")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	share.Mirror = true
+
+	// another device has the share as its mirror
+	mirrored, err := internal.GetReleaseFrom(context.Background(), server.URL+"/rauc.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, release.Version, mirrored.Version)
+	assert.Equal(t, []string{server.URL + "/"}, mirrored.Mirrors)
+
+	get := func(url string) (int, string) {
+		response, err := http.Get(url)
+		assert.NoError(t, err)
+		defer response.Body.Close()
+		buf, err := io.ReadAll(response.Body)
+		assert.NoError(t, err)
+		return response.StatusCode, string(buf)
+	}
+
+	packageURL, err := internal.GetPackageURLByCurrentArch(*mirrored, mirrored.Mirrors[0])
+	assert.NoError(t, err)
+	status, content := get(packageURL)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "package", content)
+
+	status, content = get(internal.ResolveReleaseURL(*mirrored, mirrored.Mirrors[0], mirrored.Checksums))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, content, "zimaos-99.0.0.raucb")
+
+	// only what is published is served
+	status, _ = get(server.URL + "/releases/v97.0.0/checksums.txt")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// and only for the channel of this device
+	for _, name := range []string{"rauc-beta.txt", "rauc-beta-revoked.txt", "main.txt"} {
+		status, _ = get(server.URL + "/" + name)
+		assert.Equal(t, http.StatusNotFound, status, name)
+	}
+}
+
+func TestDownloadFromServedMirror(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	// the sharing device has the release verified in its cache
+	config.ServerInfo.CachePath = t.TempDir()
+	release := checksumsTestRelease("https://mirror.example/")
+	writeCachedRelease(t, release, "package", true)
+
+	share := service.NewPeerShare("mirror")
+	share.Mirror = true
+	assert.NoError(t, share.Publish(release))
+
+	server := httptest.NewServer(share)
+	defer server.Close()
+
+	// another device has the share as its only mirror, with the default checksum origins
+	config.ServerInfo.CachePath = t.TempDir()
+	withMirrors(t, server.URL+"/")
+
+	ctx := context.Background()
+
+	fetched, err := service.FetchRelease(ctx, service.GetReleaseBranch(config.SysRoot), service.HyperFileTagReleaseURL)
+	assert.NoError(t, err)
+
+	releaseFilePath, err := service.DownloadRelease(ctx, *fetched, false)
+	assert.NoError(t, err)
+	assert.FileExists(t, releaseFilePath)
+
+	packageFilePath, err := service.RAUCFilePath(*fetched)
+	assert.NoError(t, err)
+	buf, err := os.ReadFile(packageFilePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "package", string(buf))
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/common"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+)
+
+const (
+	// how long peers are asked for with mDNS
+	peerBrowseTimeout = 2 * time.Second
+
+	// a peer which does not answer this fast is skipped, rather than retried like a mirror
+	peerProbeTimeout = 3 * time.Second
+)
+
+var ErrNoPeer = fmt.Errorf("no peer has the release")
+
+// PeerSharing is nil when neither sharing with peers nor the mirror is enabled, see config.ShareInfo
+var PeerSharing *PeerShare
+
+// PeerShare serves the packages of the cached releases which are verified against their checksums.txt to peers, and
+// the whole cache as a mirror if Mirror is set, see ServeMirror.
+type PeerShare struct {
+	instance string
+
+	// serve the verified releases as a mirror of the channel too
+	Mirror bool
+
+	lock sync.RWMutex
+
+	// version to the verified release
+	shared map[string]sharedRelease
+}
+
+type sharedRelease struct {
+	release         codegen.Release
+	packageFilePath string
+}
+
+func NewPeerShare(instance string) *PeerShare {
+	return &PeerShare{
+		instance: instance,
+		shared:   map[string]sharedRelease{},
+	}
+}
+
+// Instance is the name the share is advertised with.
+func (s *PeerShare) Instance() string {
+	return s.instance
+}
+
+// Publish verifies the package of the cached release, and shares it if it matches checksums.txt.
+func (s *PeerShare) Publish(release codegen.Release) error {
+	packageFilePath, err := RAUCFilePath(release)
+	if err != nil {
+		return err
+	}
+
+	if err := checksumVerifier(release, filepath.Base(packageFilePath))(packageFilePath); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.shared[release.Version] = sharedRelease{release: release, packageFilePath: packageFilePath}
+	s.lock.Unlock()
+
+	logger.Info("sharing release with peers", zap.String("version", release.Version), zap.String("package_file_path", packageFilePath))
+	return nil
+}
+
+// PublishCached publishes every cached release which is verified, see Publish.
+func (s *PeerShare) PublishCached() {
+	entries, _ := os.ReadDir(filepath.Join(config.ServerInfo.CachePath, "releases"))
+	for _, entry := range entries {
+		// the latest symlink is the same as one of the others
+		if !entry.IsDir() {
+			continue
+		}
+
+		releasePath := filepath.Join(config.ServerInfo.CachePath, "releases", entry.Name(), common.ReleaseYAMLFileName)
+		release, err := internal.GetReleaseFromLocal(releasePath)
+		if err != nil {
+			continue
+		}
+
+		if err := s.Publish(*release); err != nil {
+			logger.Info("not sharing cached release with peers", zap.Error(err), zap.String("version", release.Version))
+		}
+	}
+}
+
+// Versions returns the versions shared, which are not revoked.
+func (s *PeerShare) Versions() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	versions := lo.Filter(lo.Keys(s.shared), func(version string, _ int) bool {
+		return CheckRevoked(version) == nil
+	})
+	sort.Strings(versions)
+
+	return versions
+}
+
+// ServeHTTP serves `GET /releases` as the versions shared, and `GET /releases/<version>/<package>` as the package.
+func (s *PeerShare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if s.Mirror && s.ServeMirror(w, r) {
+		return
+	}
+
+	if strings.TrimSuffix(r.URL.Path, "/") == "/releases" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Versions())
+		return
+	}
+
+	version, filename, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/releases/"), "/")
+	if !ok || !strings.HasPrefix(r.URL.Path, "/releases/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	shared, ok := s.sharedRelease(version)
+	if !ok || filepath.Base(shared.packageFilePath) != filename {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.serveFile(w, r, version, shared.packageFilePath)
+}
+
+// sharedRelease returns the release of the version if it is shared, and not revoked since it is published.
+func (s *PeerShare) sharedRelease(version string) (sharedRelease, bool) {
+	s.lock.RLock()
+	shared, ok := s.shared[version]
+	s.lock.RUnlock()
+
+	return shared, ok && CheckRevoked(version) == nil
+}
+
+// serveFile serves the file of the shared version, which is not shared any more if the file is gone, e.g. evicted.
+func (s *PeerShare) serveFile(w http.ResponseWriter, r *http.Request, version string, path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		s.lock.Lock()
+		if path == s.shared[version].packageFilePath {
+			delete(s.shared, version)
+		}
+		s.lock.Unlock()
+
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// ranges are served, so that peers can resume and download in segments
+	http.ServeContent(w, r, filepath.Base(path), info.ModTime(), file)
+}
+
+// PeerPackageURL returns the URL of the package of the version on the peer.
+func PeerPackageURL(peer string, version string, filename string) string {
+	return (&url.URL{Scheme: "http", Host: peer, Path: "/releases/" + version + "/" + filename}).String()
+}
+
+// DiscoverPeers returns the peers which might have the version, the static ones of config.ShareInfo and the ones found
+// with mDNS which advertise it.
+func DiscoverPeers(ctx context.Context, version string) []string {
+	peers := append([]string{}, config.ShareInfo.Peers...)
+
+	if PeerSharing == nil || !config.ShareInfo.Enabled {
+		return lo.Uniq(peers)
+	}
+
+	found, err := internal.BrowsePeers(ctx, peerBrowseTimeout)
+	if err != nil {
+		logger.Info("error while looking for peers with mDNS", zap.Error(err))
+	}
+
+	for _, peer := range found {
+		if peer.Instance == PeerSharing.Instance() || !lo.Contains(peer.Versions, version) {
+			continue
+		}
+		peers = append(peers, peer.Addr)
+	}
+
+	return lo.Uniq(peers)
+}
+
+// DownloadFromPeers downloads the package of the release from the first peer which has it. it is verified against
+// checksums.txt in the release dir, so the checksums have to be downloaded first. returns the package file path and
+// the peer it is downloaded from.
+func DownloadFromPeers(ctx context.Context, release codegen.Release, peers []string) (string, string, error) {
+	packageFilePath, err := RAUCFilePath(release)
+	if err != nil {
+		return "", "", err
+	}
+	filename := filepath.Base(packageFilePath)
+
+	client := internal.NewHTTPClient(peerProbeTimeout)
+
+	for _, peer := range peers {
+		packageURL := PeerPackageURL(peer, release.Version, filename)
+
+		response, err := client.Head(packageURL)
+		if err == nil {
+			response.Body.Close()
+		}
+		if err != nil || response.StatusCode != http.StatusOK {
+			logger.Info("peer does not have the package - skipping", zap.Error(err), zap.String("package_url", packageURL))
+			continue
+		}
+
+		size, _ := strconv.ParseInt(response.Header.Get("Content-Length"), 10, 64)
+		if err := MakeSpace(release, size, installedVersions()...); err != nil {
+			return "", "", err
+		}
+
+		if err := internal.DownloadAs(ctx, packageFilePath, packageURL, checksumVerifier(release, filename)); err != nil {
+			if ctx.Err() != nil {
+				return "", "", err
+			}
+			logger.Error("error while downloading package from peer - trying next peer", zap.Error(err), zap.String("package_url", packageURL))
+			continue
+		}
+
+		logger.Info("downloaded package from peer", zap.String("package_url", packageURL), zap.String("package_file_path", packageFilePath))
+		return packageFilePath, peer, nil
+	}
+
+	return "", "", ErrNoPeer
+}
+
+// SharePeers serves PeerSharing on the port of config.ShareInfo, and advertises it with mDNS if sharing with peers is
+// enabled, until ctx is done.
+func SharePeers(ctx context.Context) error {
+	listener, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(config.ShareInfo.Port)))
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: PeerSharing, ReadHeaderTimeout: 10 * time.Second}
+
+	if config.ShareInfo.Enabled {
+		go func() {
+			err := internal.AdvertisePeer(ctx, internal.PeerAdvertisement{
+				Instance: PeerSharing.Instance(),
+				Port:     listener.Addr().(*net.TCPAddr).Port,
+				Versions: PeerSharing.Versions,
+			})
+			if err != nil {
+				logger.Error("error when trying to advertise with mDNS - peers have to be configured", zap.Error(err))
+			}
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
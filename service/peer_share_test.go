@@ -0,0 +1,93 @@
+package service_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/common"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/IceWhaleTech/CasaOS-Installer/service"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCachedRelease puts checksums.txt of the content in the release dir, and the package if withPackage
+func writeCachedRelease(t *testing.T, release codegen.Release, content string, withPackage bool) string {
+	packageFilePath, err := service.RAUCFilePath(release)
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(packageFilePath), 0o755))
+
+	sum := sha256.Sum256([]byte(content))
+	checksums := hex.EncodeToString(sum[:]) + "  " + filepath.Base(packageFilePath) + "\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(packageFilePath), common.ChecksumsTXTFileName), []byte(checksums), 0o600))
+
+	if withPackage {
+		assert.NoError(t, os.WriteFile(packageFilePath, []byte(content), 0o600))
+	}
+
+	return packageFilePath
+}
+
+func TestPeerShare(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	release := checksumsTestRelease()
+
+	// the first installer has the release verified in its cache
+	config.ServerInfo.CachePath = t.TempDir()
+	writeCachedRelease(t, release, "package", true)
+
+	share := service.NewPeerShare("first")
+	assert.NoError(t, share.Publish(release))
+	assert.Error(t, share.Publish(codegen.Release{Version: "v98.0.0", Packages: release.Packages}))
+
+	peer := httptest.NewServer(share)
+	defer peer.Close()
+
+	response, err := http.Get(peer.URL + "/releases")
+	assert.NoError(t, err)
+	var versions []string
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&versions))
+	response.Body.Close()
+	assert.Equal(t, []string{release.Version}, versions)
+
+	response, err = http.Get(peer.URL + "/releases/v98.0.0/zimaos-99.0.0.raucb")
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+
+	peers := []string{strings.TrimPrefix(notFound.URL, "http://"), strings.TrimPrefix(peer.URL, "http://")}
+
+	// the second installer downloads it from the first one
+	config.ServerInfo.CachePath = t.TempDir()
+	packageFilePath := writeCachedRelease(t, release, "package", false)
+
+	downloaded, from, err := service.DownloadFromPeers(context.Background(), release, peers)
+	assert.NoError(t, err)
+	assert.Equal(t, packageFilePath, downloaded)
+	assert.Equal(t, peers[1], from)
+
+	buf, err := os.ReadFile(packageFilePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "package", string(buf))
+
+	// a package which does not match the checksums of the second one is not taken
+	config.ServerInfo.CachePath = t.TempDir()
+	packageFilePath = writeCachedRelease(t, release, "another package", false)
+
+	_, _, err = service.DownloadFromPeers(context.Background(), release, peers)
+	assert.ErrorIs(t, err, service.ErrNoPeer)
+	assert.NoFileExists(t, packageFilePath)
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/samber/lo"
+)
+
+const (
+	// progress is reported at most once in the interval, downloads call back for every read
+	downloadProgressInterval = time.Second
+
+	// the speed is averaged over the window, so that it does not jump around
+	downloadSpeedWindow = 5 * time.Second
+)
+
+type progressSample struct {
+	at         time.Time
+	downloaded int64
+}
+
+// DownloadProgressMeter turns the callbacks of a download into throttled progress reports with the speed and ETA.
+type DownloadProgressMeter struct {
+	report     func(progress codegen.DownloadProgress)
+	samples    []progressSample
+	lastReport time.Time
+	lock       sync.Mutex
+}
+
+func NewDownloadProgressMeter(report func(progress codegen.DownloadProgress)) *DownloadProgressMeter {
+	return &DownloadProgressMeter{report: report}
+}
+
+// Update is the callback of a download, see internal.WithDownloadProgress
+func (m *DownloadProgressMeter) Update(downloaded, totalSize int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := time.Now()
+	completed := totalSize >= 0 && downloaded >= totalSize
+
+	if !completed && now.Sub(m.lastReport) < downloadProgressInterval {
+		return
+	}
+
+	// a new download is started, e.g. the full package after a delta failed
+	if len(m.samples) > 0 && downloaded < m.samples[len(m.samples)-1].downloaded {
+		m.samples = nil
+	}
+
+	m.samples = append(lo.DropWhile(m.samples, func(sample progressSample) bool {
+		return now.Sub(sample.at) > downloadSpeedWindow
+	}), progressSample{at: now, downloaded: downloaded})
+
+	var speed int64
+	if oldest := m.samples[0]; now.After(oldest.at) {
+		speed = int64(float64(downloaded-oldest.downloaded) / now.Sub(oldest.at).Seconds())
+	}
+
+	m.lastReport = now
+	m.report(EstimateDownloadProgress(downloaded, totalSize, speed))
+}
+
+// EstimateDownloadProgress returns the progress with the ETA, which is left out if the size or the speed is unknown.
+func EstimateDownloadProgress(downloaded, totalSize, speed int64) codegen.DownloadProgress {
+	progress := codegen.DownloadProgress{
+		Downloaded: downloaded,
+		Total:      totalSize,
+		Speed:      speed,
+	}
+
+	if totalSize >= 0 && downloaded >= totalSize {
+		progress.Eta = lo.ToPtr(int64(0))
+	} else if totalSize > 0 && speed > 0 {
+		progress.Eta = lo.ToPtr((totalSize - downloaded + speed - 1) / speed)
+	}
+
+	return progress
+}
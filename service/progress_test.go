@@ -0,0 +1,40 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/service"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateDownloadProgress(t *testing.T) {
+	progress := service.EstimateDownloadProgress(100, 1000, 100)
+	assert.Equal(t, lo.ToPtr(int64(9)), progress.Eta)
+
+	progress = service.EstimateDownloadProgress(100, 1000, 0)
+	assert.Nil(t, progress.Eta)
+
+	progress = service.EstimateDownloadProgress(100, -1, 100)
+	assert.Nil(t, progress.Eta)
+
+	progress = service.EstimateDownloadProgress(1000, 1000, 0)
+	assert.Equal(t, lo.ToPtr(int64(0)), progress.Eta)
+}
+
+func TestDownloadProgressMeter(t *testing.T) {
+	reports := []codegen.DownloadProgress{}
+	meter := service.NewDownloadProgressMeter(func(progress codegen.DownloadProgress) {
+		reports = append(reports, progress)
+	})
+
+	meter.Update(10, 1000)
+	meter.Update(20, 1000) // throttled
+	meter.Update(1000, 1000)
+
+	assert.Len(t, reports, 2)
+	assert.Equal(t, int64(10), reports[0].Downloaded)
+	assert.Equal(t, int64(1000), reports[1].Downloaded)
+	assert.Equal(t, lo.ToPtr(int64(0)), reports[1].Eta)
+}
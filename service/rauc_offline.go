@@ -74,6 +74,11 @@ func (r *RAUCOfflineService) GetRelease(ctx context.Context, tag string, useCach
 	return release, err
 }
 
+func (r *RAUCOfflineService) GetRevocationList(ctx context.Context, tag string) (*internal.RevocationList, error) {
+	// the offline bundle is put there by the user, the revocation list fetched before still applies
+	return &internal.RevocationList{}, nil
+}
+
 func (r *RAUCOfflineService) Launch(sysRoot string) error {
 	if _, err := os.Stat(filepath.Join(sysRoot, FlagUpgradeFile)); os.IsNotExist(err) {
 		return nil
@@ -108,7 +113,8 @@ func (r *RAUCOfflineService) PostInstall(release codegen.Release, sysRoot string
 }
 
 func (r *RAUCOfflineService) ShouldUpgrade(release codegen.Release, sysRoot string) bool {
-	return ShouldUpgrade(release, sysRoot)
+	// the offline bundle is put there by the user, so the rollout does not apply. a revoked one is not installed still
+	return isInstallableRelease(release, sysRoot)
 }
 
 func (r *RAUCOfflineService) IsUpgradable(release codegen.Release, sysRootPath string) bool {
@@ -85,6 +85,10 @@ func (r *RAUCService) GetRelease(ctx context.Context, tag string, useCache bool)
 	return FetchRelease(ctx, tag, r.URLHandler)
 }
 
+func (r *RAUCService) GetRevocationList(ctx context.Context, tag string) (*internal.RevocationList, error) {
+	return FetchRevocationList(ctx, tag)
+}
+
 func (r *RAUCService) VerifyRelease(release codegen.Release) (string, error) {
 	_, err := checksum.OnlineRAUCExist(release)
 	if err == nil && r.hasChecked {
@@ -103,7 +107,26 @@ func (r *RAUCService) CleanRelease(ctx context.Context, release codegen.Release)
 	if err != nil {
 		return err
 	}
-	return os.RemoveAll(releaseDir)
+
+	entries, err := os.ReadDir(releaseDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// partial downloads are kept to be resumed
+	for _, entry := range entries {
+		if internal.IsPartialDownload(entry.Name()) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(releaseDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (r *RAUCService) DownloadRelease(ctx context.Context, release codegen.Release, force bool) (string, error) {
@@ -123,6 +146,13 @@ func (r *RAUCService) DownloadRelease(ctx context.Context, release codegen.Relea
 		return "", err
 	}
 	filePath, err = r.VerifyRelease(release)
+	if err == nil && PeerSharing != nil {
+		go func() {
+			if err := PeerSharing.Publish(release); err != nil {
+				logger.Error("error when trying to share release with peers", zap.Error(err), zap.String("version", release.Version))
+			}
+		}()
+	}
 	return filePath, err
 }
 
@@ -50,14 +50,13 @@ func HyperFileTagReleaseURL(tag string, mirror string) string {
 
 type BestURLFunc func(urls []string) string
 
+// Deprecated: the result is used once and never refreshed. use Mirrors.Probe and Mirrors.Rank instead.
 func BestByDelay(urls []string) string {
 	ch := make(chan string)
 
 	for _, url := range urls {
 		go func(url string) {
-			client := &http.Client{
-				Timeout: 5 * time.Second,
-			}
+			client := internal.NewHTTPClient(internal.RetryPolicy().ProbeTimeout)
 			resp, err := client.Head(url)
 			if err != nil || resp.StatusCode != http.StatusOK {
 				ch <- "" // Send an empty string to indicate failure
@@ -70,7 +69,6 @@ func BestByDelay(urls []string) string {
 	// Wait for the first successful response or all goroutines to finish
 	for range urls {
 		if ret := <-ch; ret != "" {
-			config.ServerInfo.BestURL = ret
 			return ret
 		}
 	}
@@ -81,23 +79,43 @@ func BestByDelay(urls []string) string {
 	return urls[0] // Return first url if no successful response is received
 }
 
+// FetchRelease fetches the release from the mirrors of the current channel, from the best ranked to the worst.
 func FetchRelease(ctx context.Context, tag string, constructReleaseFileURLFunc ConstructReleaseFileURLFunc) (*codegen.Release, error) {
-	url := config.ServerInfo.BestURL
-	if len(config.ServerInfo.BestURL) == 0 {
-		var releaseURL []string
-		for _, mirror := range config.ServerInfo.Mirrors {
-			releaseURL = append(releaseURL, constructReleaseFileURLFunc(tag, mirror))
+	err := fmt.Errorf("no mirror found")
+	var untrustedErr error
+
+	for _, mirror := range Mirrors.Rank(config.ServerInfo.Mirrors) {
+		url := constructReleaseFileURLFunc(tag, mirror)
+		logger.Info("fetching release", zap.String("tag", tag), zap.String("url", url))
+
+		start := time.Now()
+		var release *codegen.Release
+		release, err = internal.GetReleaseFrom(ctx, url)
+		if err != nil {
+			logger.Error("failed to get release information from url - trying next mirror", zap.String("url", url), zap.Error(err))
+			Mirrors.ReportFailure(mirror, err)
+			if internal.IsUntrustedRelease(err) {
+				untrustedErr = err
+			}
+			continue
 		}
-		var best BestURLFunc = BestByDelay // dependency inject
-		url = best(releaseURL)
+
+		Mirrors.ReportSuccess(mirror, time.Since(start))
+		internal.ExpandReleaseLinks(release, mirror)
+
+		// a manifest copied to a share or a stick lists the online mirrors, which an air-gapped device cannot reach
+		if internal.IsLocalMirror(mirror) && !lo.Contains(release.Mirrors, mirror) {
+			release.Mirrors = append([]string{mirror}, release.Mirrors...)
+		}
+
+		return release, nil
 	}
-	logger.Info("fetching release", zap.String("tag", tag), zap.String("url", url))
-	release, err := internal.GetReleaseFrom(ctx, url)
-	if err != nil {
-		logger.Error("failed to get release information from url", zap.String("url", url), zap.Error(err))
-		return release, err
+
+	// an untrusted release is worth more attention than a mirror being down
+	if untrustedErr != nil {
+		return nil, untrustedErr
 	}
-	return release, nil
+	return nil, err
 }
 
 func GetRelease(ctx context.Context, tag string) (*codegen.Release, error) {
@@ -131,61 +149,184 @@ func DownloadRelease(ctx context.Context, release codegen.Release, force bool) (
 		return "", err
 	}
 
-	var packageFilePath string
-	var mirror string
+	// checksums.txt is not trusted from the package mirror, see DownloadTrustedChecksums.
+	// it is needed before the download to verify a package reconstructed from a delta.
+	if _, err := DownloadTrustedChecksums(ctx, release); err != nil {
+		logger.Error("error while downloading checksums", zap.Error(err))
+		return "", err
+	}
 
-	remainingSpace, _ := internal.GetRemainingSpace(config.RAUC_RELEASE_PATH)
-	packageURL := ""
+	// peers on the LAN go first, the package from them is verified like the one from a mirror
+	packageFilePath, _, err := DownloadFromPeers(ctx, release, DiscoverPeers(ctx, release.Version))
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
 
-	for _, mirror = range release.Mirrors {
-		// download packages if any of them is missing
-		packageURL, err = internal.GetPackageURLByCurrentArch(release, mirror)
+		var mirror string
+		packageFilePath, mirror, err = DownloadDelta(ctx, release, config.SysRoot)
 		if err != nil {
-			logger.Error("error while getting package url - skipping", zap.Error(err), zap.Any("release", release))
-			continue
+			// stopped by the user, rather than a delta which does not apply
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+
+			logger.Info("falling back to the full package", zap.Error(err), zap.String("release_version", release.Version))
+			packageFilePath, mirror, err = downloadPackage(ctx, release, releaseDir)
+			if err != nil {
+				return "", err
+			}
 		}
 
-		resp, err := http.Head(packageURL)
-		if err != nil || resp.StatusCode != http.StatusOK {
-			logger.Error("error while getting package url - skipping", zap.Error(err), zap.String("package_url", packageURL))
-			continue
+		if packageFilePath == "" {
+			return "", fmt.Errorf("download fail")
 		}
-		fileSize, _ := strconv.Atoi(resp.Header.Get("Content-Length"))
-		if uint64(fileSize) > remainingSpace {
-			logger.Error("not enough space to download package - skipping")
+
+		release.Mirrors = []string{mirror}
+	}
+
+	buf, err := yaml.Marshal(release)
+	if err != nil {
+		return "", err
+	}
+
+	releaseFilePath := filepath.Join(releaseDir, common.ReleaseYAMLFileName)
+	return releaseFilePath, os.WriteFile(releaseFilePath, buf, 0o600)
+}
+
+// packageSource is a mirror which has the package, see downloadPackage
+type packageSource struct {
+	mirror string
+	url    string
+	size   int64
+
+	// the mirror supports range requests
+	ranges bool
+}
+
+// downloadPackage downloads the full package. it is downloaded in segments from all mirrors which have it if more
+// than one of them supports range requests, or from the best mirror that works otherwise. returns the package file
+// path and the mirror which contributed the most, or an error if there is no space for the package.
+func downloadPackage(ctx context.Context, release codegen.Release, releaseDir string) (string, string, error) {
+	sources := packageSources(ctx, release)
+	if ctx.Err() != nil {
+		return "", "", ctx.Err()
+	}
+
+	// the size is unknown if no mirror has the package, which fails below
+	if size := lo.Max(lo.Map(sources, func(source packageSource, _ int) int64 { return source.size })); size > 0 {
+		if err := MakeSpace(release, size, installedVersions()...); err != nil {
+			logger.Error("error while making space for package", zap.Error(err))
+			return "", "", err
+		}
+	}
+
+	packageFilePath, mirror, err := downloadPackageSegmented(ctx, release, releaseDir, sources)
+	if err == nil {
+		return packageFilePath, mirror, nil
+	}
+	if ctx.Err() != nil {
+		return "", "", ctx.Err()
+	}
+	logger.Info("downloading package from a single mirror", zap.Error(err))
+
+	for _, source := range sources {
+		start := time.Now()
+		packageFilePath, err := internal.Download(ctx, releaseDir, source.url, checksumVerifier(release, filepath.Base(source.url)))
+		if err != nil {
+			// the mirror is not to blame if the download is stopped
+			if ctx.Err() != nil {
+				return "", "", ctx.Err()
+			}
+
+			logger.Error("error while downloading and extracting package", zap.Error(err), zap.String("package_url", source.url))
+			Mirrors.ReportFailure(source.mirror, err)
 			continue
 		}
+		Mirrors.ReportThroughput(source.mirror, source.size, time.Since(start))
+		logger.Info("downloaded package success", zap.String("package_url", source.url), zap.String("package_file_path", packageFilePath))
+
+		return packageFilePath, source.mirror, nil
+	}
+
+	return "", "", nil
+}
 
-		packageFilePath, err = internal.Download(ctx, releaseDir, packageURL)
+// packageSources returns the mirrors which have the package, best mirror first.
+func packageSources(ctx context.Context, release codegen.Release) []packageSource {
+	sources := []packageSource{}
+	for _, mirror := range Mirrors.Rank(release.Mirrors) {
+		packageURL, err := internal.GetPackageURLByCurrentArch(release, mirror)
 		if err != nil {
-			logger.Error("error while downloading and extracting package", zap.Error(err), zap.String("package_url", packageURL))
+			logger.Error("error while getting package url - skipping", zap.Error(err), zap.Any("release", release))
 			continue
 		}
-		logger.Info("downloaded package success", zap.String("package_url", packageURL), zap.String("package_file_path", packageFilePath))
 
-		// download checksums.txt if it's missing
-		checksumsURL := internal.GetChecksumsURL(release, mirror)
-		if _, err = internal.Download(ctx, releaseDir, checksumsURL); err != nil {
-			logger.Error("error while downloading checksums", zap.Error(err), zap.String("checksums_url", checksumsURL))
+		start := time.Now()
+		resp, err := internal.Probe(ctx, packageURL)
+		if ctx.Err() != nil {
+			return sources
+		}
+		if err != nil || resp.StatusCode != http.StatusOK {
+			logger.Error("error while getting package url - skipping", zap.Error(err), zap.String("package_url", packageURL))
+			if err == nil {
+				err = fmt.Errorf("failed to get %s - %s", packageURL, resp.Status)
+			}
+			Mirrors.ReportFailure(mirror, err)
 			continue
 		}
+		Mirrors.ReportSuccess(mirror, time.Since(start))
+
+		fileSize, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
 
-		break
+		sources = append(sources, packageSource{
+			mirror: mirror,
+			url:    packageURL,
+			size:   fileSize,
+			ranges: resp.Header.Get("Accept-Ranges") == "bytes",
+		})
 	}
 
-	if packageFilePath == "" {
-		return "", fmt.Errorf("download fail")
+	return sources
+}
+
+// downloadPackageSegmented downloads the package in segments from the sources, see internal.DownloadSegmented
+func downloadPackageSegmented(ctx context.Context, release codegen.Release, releaseDir string, sources []packageSource) (string, string, error) {
+	// all of them have to serve the same file
+	sources = lo.Filter(sources, func(source packageSource, _ int) bool {
+		return source.ranges && source.size > 0 && source.size == sources[0].size
+	})
+	if len(sources) < 2 {
+		return "", "", fmt.Errorf("segmented download needs at least 2 mirrors which support range requests")
 	}
 
-	release.Mirrors = []string{mirror}
+	packageFilename := filepath.Base(sources[0].url)
+	packageFilePath := filepath.Join(releaseDir, packageFilename)
+
+	urls := lo.Map(sources, func(source packageSource, _ int) string { return source.url })
+
+	stats, err := internal.DownloadSegmented(ctx, packageFilePath, urls, sources[0].size, checksumVerifier(release, packageFilename))
+
+	mirror := ""
+	var mostDownloaded int64
+	for i, stat := range stats {
+		if stat.Downloaded > 0 {
+			Mirrors.ReportThroughput(sources[i].mirror, stat.Downloaded, stat.Elapsed)
+		} else if stat.Err != nil && ctx.Err() == nil {
+			Mirrors.ReportFailure(sources[i].mirror, stat.Err)
+		}
+
+		if stat.Downloaded > mostDownloaded {
+			mirror, mostDownloaded = sources[i].mirror, stat.Downloaded
+		}
+	}
 
-	buf, err := yaml.Marshal(release)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	releaseFilePath := filepath.Join(releaseDir, common.ReleaseYAMLFileName)
-	return releaseFilePath, os.WriteFile(releaseFilePath, buf, 0o600)
+	logger.Info("downloaded package success", zap.String("package_file_path", packageFilePath), zap.Any("sources", stats))
+	return packageFilePath, mirror, nil
 }
 
 func IsZimaOS(sysRoot string) bool {
@@ -343,7 +484,35 @@ func IsNewerVersion(current *semver.Version, target *semver.Version) bool {
 	return IsNewerVersionString(current.String(), target.String())
 }
 
+// ShouldUpgrade returns true if the release is newer than the current one, and rolled out to this device.
 func ShouldUpgrade(release codegen.Release, sysRootPath string) bool {
+	if !isInstallableRelease(release, sysRootPath) {
+		return false
+	}
+
+	if rollout := GetRolloutStatus(release, sysRootPath); !rollout.Included {
+		logger.Info("release is not rolled out to this device yet - considered as up to date", zap.String("release_version", release.Version), zap.Any("rollout", rollout))
+		return false
+	}
+
+	return true
+}
+
+// isInstallableRelease returns true if the release is newer than the installed one, and not revoked.
+func isInstallableRelease(release codegen.Release, sysRootPath string) bool {
+	if !isNewerRelease(release, sysRootPath) {
+		return false
+	}
+
+	if err := CheckRevoked(release.Version); err != nil {
+		logger.Info("release is revoked - considered as up to date", zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func isNewerRelease(release codegen.Release, sysRootPath string) bool {
 	if release.Version == "" {
 		return false
 	}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/Masterminds/semver/v3"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrReleaseInstalled    = fmt.Errorf("release is already installed")
+	ErrDowngradeNotAllowed = fmt.Errorf("downgrade is not allowed")
+)
+
+func HyperFileTagReleaseIndexURL(tag string, mirror string) string {
+	// https://casaos.oss-cn-shanghai.aliyuncs.com/IceWhaleTech/zimaos-rauc/rauc-index.txt
+	return mirror + tag + "-index.txt"
+}
+
+// FetchReleaseIndex returns the release index of the channel and the mirror it is fetched from
+func FetchReleaseIndex(ctx context.Context, tag string) (*internal.ReleaseIndex, string, error) {
+	var lastErr error
+	for _, mirror := range Mirrors.Rank(config.ServerInfo.Mirrors) {
+		indexURL := HyperFileTagReleaseIndexURL(tag, mirror)
+
+		start := time.Now()
+		index, err := internal.GetReleaseIndexFrom(ctx, indexURL)
+		if err != nil {
+			logger.Info("error while getting release index - skipping", zap.Error(err), zap.String("url", indexURL))
+			Mirrors.ReportFailure(mirror, err)
+			lastErr = err
+			continue
+		}
+
+		Mirrors.ReportSuccess(mirror, time.Since(start))
+		return index, mirror, nil
+	}
+
+	return nil, "", fmt.Errorf("%w: no release index for channel %s (%v)", ErrReleaseNotFound, tag, lastErr)
+}
+
+func findReleaseIndexEntry(index internal.ReleaseIndex, version string) (internal.ReleaseIndexEntry, bool) {
+	return lo.Find(index.Releases, func(entry internal.ReleaseIndexEntry) bool {
+		return NormalizeVersion(entry.Version) == NormalizeVersion(version)
+	})
+}
+
+// GetReleaseByVersion returns the release of a version listed in the release index of the channel
+func GetReleaseByVersion(ctx context.Context, tag string, version string) (*codegen.Release, error) {
+	index, mirror, err := FetchReleaseIndex(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, ok := findReleaseIndexEntry(*index, version)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not listed in channel %s", ErrReleaseNotFound, version, tag)
+	}
+
+	// the mirror which served the index goes first
+	mirrors := append([]string{mirror}, Mirrors.Rank(config.ServerInfo.Mirrors)...)
+	for _, mirror := range lo.Uniq(mirrors) {
+		releaseURL := strings.TrimSuffix(mirror, "/") + entry.Path
+		logger.Info("fetching release by version", zap.String("version", version), zap.String("url", releaseURL))
+
+		start := time.Now()
+		var release *codegen.Release
+		release, err = internal.GetReleaseFrom(ctx, releaseURL)
+		if err != nil {
+			logger.Info("error while getting release - trying next mirror", zap.Error(err), zap.String("url", releaseURL))
+			Mirrors.ReportFailure(mirror, err)
+			continue
+		}
+		Mirrors.ReportSuccess(mirror, time.Since(start))
+
+		if NormalizeVersion(release.Version) != NormalizeVersion(entry.Version) {
+			return nil, fmt.Errorf("release index lists %s, but the manifest %s is for %s", entry.Version, releaseURL, release.Version)
+		}
+
+		internal.ExpandReleaseLinks(release, mirror)
+		return release, nil
+	}
+
+	return nil, err
+}
+
+// CheckInstallPolicy returns an error if the version is not allowed to be installed on purpose
+func CheckInstallPolicy(version string, sysRoot string) error {
+	if err := CheckRevoked(version); err != nil {
+		return err
+	}
+
+	targetVersion, err := semver.NewVersion(NormalizeVersion(version))
+	if err != nil {
+		return err
+	}
+
+	currentVersion, err := CurrentReleaseVersion(sysRoot)
+	if err != nil {
+		logger.Info("error while getting current release version - skip install policy", zap.Error(err))
+		return nil
+	}
+
+	if !IsNewerVersion(currentVersion, targetVersion) && !IsNewerVersion(targetVersion, currentVersion) {
+		return ErrReleaseInstalled
+	}
+
+	if IsNewerVersion(targetVersion, currentVersion) && !config.ServerInfo.AllowDowngrade {
+		return ErrDowngradeNotAllowed
+	}
+
+	return nil
+}
+
+// ListReleases lists the releases in the release index of the channel, and whether they are installable on this device
+func ListReleases(ctx context.Context, tag string, sysRoot string) ([]codegen.ReleaseSummary, error) {
+	index, _, err := FetchReleaseIndex(ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	arch := internal.CurrentArchitecture()
+
+	return lo.Map(index.Releases, func(entry internal.ReleaseIndexEntry, _ int) codegen.ReleaseSummary {
+		summary := codegen.ReleaseSummary{
+			Version:      entry.Version,
+			ReleaseNotes: lo.ToPtr(entry.ReleaseNotes),
+			Important:    lo.ToPtr(entry.Important),
+		}
+
+		err := CheckInstallPolicy(entry.Version, sysRoot)
+		summary.Installed = err == ErrReleaseInstalled
+
+		if err == nil && len(entry.Architectures) > 0 && !lo.Contains(entry.Architectures, arch) {
+			err = fmt.Errorf("no package for architecture %s", arch)
+		}
+
+		summary.Installable = err == nil
+		if err != nil {
+			summary.Reason = lo.ToPtr(err.Error())
+		}
+
+		return summary
+	}), nil
+}
@@ -0,0 +1,102 @@
+package service_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/common/fixtures"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/IceWhaleTech/CasaOS-Installer/service"
+	"github.com/stretchr/testify/assert"
+)
+
+const releaseIndexYAML = `releases:
+  - version: v1.2.0
+    release_notes: not for this device
+    path: /releases/v1.2.0.txt
+    architectures:
+      - riscv64
+  - version: v1.1.0
+    release_notes: the next one
+    important: true
+    path: /releases/v1.1.0.txt
+  - version: v1.0.0
+    path: /releases/v1.0.0.txt
+  - version: v0.9.0
+    path: /releases/v0.9.0.txt
+`
+
+const releaseV110YAML = `version: v1.1.0
+release_notes: the next one
+mirrors:
+  - https://casaos.io
+packages:
+  - path: /zimaos-1.1.0.raucb
+    architecture: amd64
+  - path: /zimaos-1.1.0.raucb
+    architecture: arm64
+  - path: /zimaos-1.1.0.raucb
+    architecture: arm-7
+checksums: /checksums.txt
+`
+
+func TestReleaseIndex(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rauc-index.txt":
+			w.Write([]byte(releaseIndexYAML))
+		case "/releases/v1.1.0.txt":
+			w.Write([]byte(releaseV110YAML))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	mirrors := config.ServerInfo.Mirrors
+	defer func() {
+		config.ServerInfo.Mirrors = mirrors
+		config.ServerInfo.AllowDowngrade = false
+	}()
+	config.ServerInfo.Mirrors = []string{server.URL + "/"}
+	config.ServerInfo.CachePath = t.TempDir()
+
+	sysRoot := t.TempDir()
+	fixtures.SetLocalRelease(sysRoot, "v1.0.0")
+
+	ctx := context.Background()
+
+	releases, err := service.ListReleases(ctx, "rauc", sysRoot)
+	assert.NoError(t, err)
+	assert.Len(t, releases, 4)
+
+	assert.False(t, releases[0].Installable)
+	assert.Contains(t, *releases[0].Reason, "architecture")
+
+	assert.True(t, releases[1].Installable)
+	assert.True(t, *releases[1].Important)
+
+	assert.True(t, releases[2].Installed)
+	assert.False(t, releases[2].Installable)
+
+	assert.False(t, releases[3].Installable)
+	assert.Equal(t, service.ErrDowngradeNotAllowed.Error(), *releases[3].Reason)
+
+	config.ServerInfo.AllowDowngrade = true
+	assert.NoError(t, service.CheckInstallPolicy("v0.9.0", sysRoot))
+
+	release, err := service.GetReleaseByVersion(ctx, "rauc", "1.1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.1.0", release.Version)
+
+	_, err = service.GetReleaseByVersion(ctx, "rauc", "v3.0.0")
+	assert.ErrorIs(t, err, service.ErrReleaseNotFound)
+
+	_, err = service.ListReleases(ctx, "no-such-channel", sysRoot)
+	assert.ErrorIs(t, err, service.ErrReleaseNotFound)
+}
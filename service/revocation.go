@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+)
+
+const RevocationListFileName = "revoked.yaml"
+
+var ErrReleaseRevoked = fmt.Errorf("release is revoked")
+
+func HyperFileTagRevocationListURL(tag string, mirror string) string {
+	// https://casaos.oss-cn-shanghai.aliyuncs.com/IceWhaleTech/zimaos-rauc/rauc-revoked.txt
+	return mirror + tag + "-revoked.txt"
+}
+
+// RevocationListPath is where the last fetched revocation list is kept, so that revoked releases stay refused offline.
+func RevocationListPath() string {
+	return filepath.Join(config.ServerInfo.CachePath, RevocationListFileName)
+}
+
+// FetchRevocationList fetches the revocation list of the channel and keeps it on disk. a channel without a revocation
+// list revokes nothing.
+func FetchRevocationList(ctx context.Context, tag string) (*internal.RevocationList, error) {
+	var lastErr error
+	for _, mirror := range Mirrors.Rank(config.ServerInfo.Mirrors) {
+		listURL := HyperFileTagRevocationListURL(tag, mirror)
+
+		start := time.Now()
+		list, err := internal.GetRevocationListFrom(ctx, listURL)
+		if errors.Is(err, internal.ErrRevocationListNotFound) {
+			Mirrors.ReportSuccess(mirror, time.Since(start))
+			list = &internal.RevocationList{}
+		} else if err != nil {
+			logger.Info("error while getting revocation list - skipping", zap.Error(err), zap.String("url", listURL))
+			Mirrors.ReportFailure(mirror, err)
+			lastErr = err
+			continue
+		} else {
+			Mirrors.ReportSuccess(mirror, time.Since(start))
+		}
+
+		if err := internal.WriteRevocationListToLocal(list, RevocationListPath()); err != nil {
+			logger.Error("error when trying to keep the revocation list", zap.Error(err))
+		}
+
+		return list, nil
+	}
+
+	return nil, fmt.Errorf("failed to get revocation list for channel %s: %w", tag, lastErr)
+}
+
+// CheckRevoked returns an error wrapping ErrReleaseRevoked with the reason, if the version is in the last fetched revocation list.
+func CheckRevoked(version string) error {
+	list, err := internal.GetRevocationListFromLocal(RevocationListPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("error when trying to read the revocation list", zap.Error(err))
+		}
+		return nil
+	}
+
+	revoked, ok := lo.Find(list.Revoked, func(revoked internal.RevokedRelease) bool {
+		return NormalizeVersion(revoked.Version) == NormalizeVersion(version)
+	})
+	if !ok {
+		return nil
+	}
+
+	return RevokedError(internal.RevokedRelease{Version: version, Reason: revoked.Reason})
+}
+
+// RevokedError returns an error wrapping ErrReleaseRevoked, with the reason if there is one.
+func RevokedError(revoked internal.RevokedRelease) error {
+	if revoked.Reason == "" {
+		return fmt.Errorf("%w: %s", ErrReleaseRevoked, revoked.Version)
+	}
+	return fmt.Errorf("%w: %s - %s", ErrReleaseRevoked, revoked.Version, revoked.Reason)
+}
+
+// PurgeRevokedReleases removes the cached releases which are revoked, and returns the ones removed.
+func PurgeRevokedReleases(list internal.RevocationList) []internal.RevokedRelease {
+	purged := []internal.RevokedRelease{}
+
+	for _, revoked := range list.Revoked {
+		// the release dir is named after the version in the manifest, which might go with or without `v`
+		for _, version := range lo.Uniq([]string{revoked.Version, NormalizeVersion(revoked.Version)}) {
+			if purgeRelease(version) {
+				logger.Info("removed revoked release", zap.String("version", version), zap.String("reason", revoked.Reason))
+				purged = append(purged, internal.RevokedRelease{Version: version, Reason: revoked.Reason})
+			}
+		}
+	}
+
+	return purged
+}
+
+// purgeRelease removes the release dir of the version, returns true if there was one.
+func purgeRelease(version string) bool {
+	releaseDir, err := config.ReleaseDir(codegen.Release{Version: version})
+	if err != nil {
+		return false
+	}
+
+	if _, err := os.Stat(releaseDir); err != nil {
+		return false
+	}
+
+	// the latest symlink would be left dangling
+	latestReleaseDir := filepath.Join(filepath.Dir(releaseDir), "latest")
+	if link, _ := os.Readlink(latestReleaseDir); link == releaseDir {
+		os.Remove(latestReleaseDir)
+	}
+
+	if err := os.RemoveAll(releaseDir); err != nil {
+		logger.Error("error when trying to remove revoked release", zap.Error(err), zap.String("dir", releaseDir))
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,76 @@
+package service_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/common/fixtures"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/IceWhaleTech/CasaOS-Installer/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevocationList(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	revoked := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rauc-revoked.txt" || !revoked {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("revoked:\n  - version: v1.1.0\n    reason: bricks some boards\n"))
+	}))
+	defer server.Close()
+
+	cachePath := config.ServerInfo.CachePath
+	defer func() { config.ServerInfo.CachePath = cachePath }()
+	config.ServerInfo.CachePath = t.TempDir()
+
+	withMirrors(t, server.URL+"/")
+
+	// nothing is revoked before the list is fetched
+	assert.NoError(t, service.CheckRevoked("v1.1.0"))
+
+	releaseDir, err := config.ReleaseDir(codegen.Release{Version: "v1.1.0"})
+	assert.NoError(t, err)
+	assert.NoError(t, os.MkdirAll(releaseDir, 0o755))
+	latestReleaseDir := filepath.Join(filepath.Dir(releaseDir), "latest")
+	assert.NoError(t, os.Symlink(releaseDir, latestReleaseDir))
+
+	list, err := service.FetchRevocationList(context.Background(), "rauc")
+	assert.NoError(t, err)
+	assert.Len(t, list.Revoked, 1)
+	assert.FileExists(t, service.RevocationListPath())
+
+	assert.Equal(t, []internal.RevokedRelease{{Version: "v1.1.0", Reason: "bricks some boards"}}, service.PurgeRevokedReleases(*list))
+	assert.NoDirExists(t, releaseDir)
+	assert.NoFileExists(t, latestReleaseDir)
+
+	err = service.CheckRevoked("1.1.0")
+	assert.ErrorIs(t, err, service.ErrReleaseRevoked)
+	assert.ErrorContains(t, err, "bricks some boards")
+	assert.ErrorIs(t, service.CheckInstallPolicy("v1.1.0", t.TempDir()), service.ErrReleaseRevoked)
+
+	// nor from an offline bundle
+	sysRoot := t.TempDir()
+	fixtures.SetLocalRelease(sysRoot, "v1.0.0")
+	offline := &service.RAUCOfflineService{SysRoot: sysRoot}
+	assert.False(t, offline.ShouldUpgrade(codegen.Release{Version: "v1.1.0"}, sysRoot))
+	assert.True(t, offline.ShouldUpgrade(codegen.Release{Version: "v1.2.0"}, sysRoot))
+	assert.NoError(t, service.CheckRevoked("v1.2.0"))
+
+	// a channel without a revocation list revokes nothing
+	revoked = false
+	list, err = service.FetchRevocationList(context.Background(), "rauc")
+	assert.NoError(t, err)
+	assert.Empty(t, list.Revoked)
+	assert.NoError(t, service.CheckRevoked("v1.1.0"))
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+)
+
+const rolloutBuckets = 100
+
+// RolloutBucket returns the bucket of the device for the version, from 0 to 99. the bucket is stable for the same
+// machine id and version, and independent between versions, so that the same devices are not always the first.
+//
+// devices without a machine id go to the last bucket, i.e. they only get a release rolled out to everyone.
+func RolloutBucket(machineID, version string) int {
+	if machineID == "" {
+		return rolloutBuckets - 1
+	}
+
+	sum := sha256.Sum256([]byte(machineID + ":" + NormalizeVersion(version)))
+	return int(binary.BigEndian.Uint64(sum[:8]) % rolloutBuckets)
+}
+
+// GetRolloutStatus returns whether the device under sysRoot gets the release. every device does if the release has no rollout.
+func GetRolloutStatus(release codegen.Release, sysRoot string) codegen.RolloutStatus {
+	status := codegen.RolloutStatus{
+		Percentage: rolloutBuckets,
+		Bucket:     RolloutBucket(internal.MachineID(sysRoot), release.Version),
+	}
+
+	if release.Rollout != nil {
+		if release.Rollout.Percentage != nil {
+			status.Percentage = *release.Rollout.Percentage
+		}
+		if release.Rollout.Halted != nil {
+			status.Halted = *release.Rollout.Halted
+		}
+	}
+
+	status.Included = !status.Halted && status.Bucket < status.Percentage
+	return status
+}
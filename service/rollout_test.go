@@ -0,0 +1,60 @@
+package service_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/common/fixtures"
+	"github.com/IceWhaleTech/CasaOS-Installer/service"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRolloutBucket(t *testing.T) {
+	// stable for the same device and version, regardless of the `v` prefix
+	assert.Equal(t, service.RolloutBucket("machine-a", "v1.2.0"), service.RolloutBucket("machine-a", "1.2.0"))
+
+	// devices spread evenly over the buckets
+	counts := make([]int, 10)
+	for i := 0; i < 10000; i++ {
+		bucket := service.RolloutBucket(fmt.Sprintf("machine-%d", i), "v1.2.0")
+		assert.True(t, bucket >= 0 && bucket < 100)
+		counts[bucket/10]++
+	}
+	for _, count := range counts {
+		assert.InDelta(t, 1000, count, 150)
+	}
+
+	assert.Equal(t, 99, service.RolloutBucket("", "v1.2.0"))
+}
+
+func TestShouldUpgradeWithRollout(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	sysRoot := t.TempDir()
+	fixtures.SetLocalRelease(sysRoot, "v1.0.0")
+
+	assert.NoError(t, os.WriteFile(filepath.Join(sysRoot, "etc", "machine-id"), []byte("0123456789abcdef0123456789abcdef\n"), 0o644))
+
+	release := codegen.Release{Version: "v1.1.0"}
+	bucket := service.RolloutBucket("0123456789abcdef0123456789abcdef", release.Version)
+
+	// without rollout every device gets the release
+	assert.True(t, service.ShouldUpgrade(release, sysRoot))
+
+	release.Rollout = &codegen.Rollout{Percentage: lo.ToPtr(bucket)}
+	assert.False(t, service.ShouldUpgrade(release, sysRoot))
+	assert.Equal(t, codegen.RolloutStatus{Percentage: bucket, Bucket: bucket}, service.GetRolloutStatus(release, sysRoot))
+
+	release.Rollout.Percentage = lo.ToPtr(bucket + 1)
+	assert.True(t, service.ShouldUpgrade(release, sysRoot))
+	assert.True(t, service.GetRolloutStatus(release, sysRoot).Included)
+
+	release.Rollout.Halted = lo.ToPtr(true)
+	assert.False(t, service.ShouldUpgrade(release, sysRoot))
+	assert.True(t, service.GetRolloutStatus(release, sysRoot).Halted)
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"go.uber.org/zap"
+)
+
+var ErrNotEnoughSpace = fmt.Errorf("not enough space")
+
+const megabyte = 1024 * 1024
+
+// ReclaimPriority is the order cached files are evicted in to make space, the lowest first.
+type ReclaimPriority int
+
+const (
+	// partial downloads of other releases
+	ReclaimTemp ReclaimPriority = iota
+	ReclaimBackground
+	ReclaimRelease
+)
+
+// Reclaimable is a cached file or dir which can be removed to make space for a download.
+type Reclaimable struct {
+	Path     string
+	Priority ReclaimPriority
+	Size     int64
+	ModTime  time.Time
+
+	remove func() error
+}
+
+// MakeSpace makes sure size bytes and the headroom of config.DownloadInfo fit in the filesystem of the release dir,
+// where the release is downloaded to. cached files are evicted if needed, except the releases of the versions to keep.
+// returns ErrNotEnoughSpace with how much is needed if they do not fit even so.
+func MakeSpace(release codegen.Release, size int64, keep ...string) error {
+	releaseDir, err := config.ReleaseDir(release)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(releaseDir, 0o755); err != nil {
+		return err
+	}
+
+	// what is partially downloaded already is resumed
+	need := size + config.DownloadInfo.Headroom*megabyte - partialDownloadSize(releaseDir)
+
+	free, err := internal.GetRemainingSpace(releaseDir)
+	if err != nil {
+		return err
+	}
+
+	candidates := ReclaimableSpace(append(keep, release.Version)...)
+	candidates = sameFilesystem(releaseDir, candidates)
+
+	evict, err := PlanEviction(int64(free), need, candidates)
+	if err != nil {
+		return fmt.Errorf("%w to download %s: need %d MB, have %d MB", err, release.Version, toMegabytes(need), toMegabytes(int64(free)))
+	}
+
+	for _, candidate := range evict {
+		logger.Info("removing cached file to make space", zap.String("path", candidate.Path), zap.Int64("size", candidate.Size))
+		if err := candidate.remove(); err != nil {
+			logger.Error("error when trying to remove cached file", zap.Error(err), zap.String("path", candidate.Path))
+		}
+	}
+
+	return nil
+}
+
+// installedVersions returns the version installed, if known. its package is the base of the delta to the next one, so
+// it is not evicted to make space, see DownloadDelta.
+func installedVersions() []string {
+	currentRelease, err := internal.GetReleaseFromLocal(filepath.Join(config.SysRoot, CurrentReleaseLocalPath))
+	if err != nil {
+		return nil
+	}
+	return []string{currentRelease.Version}
+}
+
+// PlanEviction returns the candidates to remove, in priority and then age order, so that need fits in free.
+func PlanEviction(free int64, need int64, candidates []Reclaimable) ([]Reclaimable, error) {
+	if need <= free {
+		return nil, nil
+	}
+
+	candidates = append([]Reclaimable{}, candidates...)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Priority != candidates[j].Priority {
+			return candidates[i].Priority < candidates[j].Priority
+		}
+		return candidates[i].ModTime.Before(candidates[j].ModTime)
+	})
+
+	for i, candidate := range candidates {
+		free += candidate.Size
+		if need <= free {
+			return candidates[:i+1], nil
+		}
+	}
+
+	return nil, ErrNotEnoughSpace
+}
+
+// ReclaimableSpace returns what is cached and could be removed, other than what belongs to the versions to keep.
+func ReclaimableSpace(keep ...string) []Reclaimable {
+	candidates := []Reclaimable{}
+
+	kept := func(version string) bool {
+		for _, k := range keep {
+			if version == k || NormalizeVersion(version) == NormalizeVersion(k) {
+				return true
+			}
+		}
+		return false
+	}
+
+	releasesDir := filepath.Join(config.ServerInfo.CachePath, "releases")
+	entries, _ := os.ReadDir(releasesDir)
+	for _, entry := range entries {
+		// the latest symlink goes with the release it points to, see purgeRelease
+		if !entry.IsDir() || kept(entry.Name()) {
+			continue
+		}
+		releaseDir := filepath.Join(releasesDir, entry.Name())
+		version := entry.Name()
+
+		// partial downloads go first, the release might be complete without them
+		files, _ := os.ReadDir(releaseDir)
+		for _, file := range files {
+			if !internal.IsPartialDownload(file.Name()) {
+				continue
+			}
+			path := filepath.Join(releaseDir, file.Name())
+			if candidate, ok := newReclaimable(path, ReclaimTemp); ok {
+				candidate.remove = func() error { return os.Remove(path) }
+				candidates = append(candidates, candidate)
+			}
+		}
+
+		if candidate, ok := newReclaimable(releaseDir, ReclaimRelease); ok {
+			candidate.Size -= partialDownloadSize(releaseDir)
+			candidate.remove = func() error {
+				if !purgeRelease(version) {
+					return fmt.Errorf("failed to remove release %s", version)
+				}
+				return nil
+			}
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	backgrounds, _ := filepath.Glob(config.BackgroundCachePath + "*")
+	for _, path := range backgrounds {
+		if kept(strings.TrimPrefix(path, config.BackgroundCachePath)) {
+			continue
+		}
+		if candidate, ok := newReclaimable(path, ReclaimBackground); ok {
+			path := path
+			candidate.remove = func() error { return os.Remove(path) }
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	return candidates
+}
+
+func newReclaimable(path string, priority ReclaimPriority) (Reclaimable, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Reclaimable{}, false
+	}
+
+	return Reclaimable{
+		Path:     path,
+		Priority: priority,
+		Size:     diskUsage(path),
+		ModTime:  info.ModTime(),
+	}, true
+}
+
+// diskUsage returns the space used by the file, or by all files in the dir.
+func diskUsage(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			size += allocatedSize(info)
+		}
+		return nil
+	})
+	return size
+}
+
+// partialDownloadSize returns the space used by the partial downloads in the release dir.
+func partialDownloadSize(releaseDir string) int64 {
+	var size int64
+	entries, _ := os.ReadDir(releaseDir)
+	for _, entry := range entries {
+		if !internal.IsPartialDownload(entry.Name()) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			size += allocatedSize(info)
+		}
+	}
+	return size
+}
+
+// allocatedSize returns the space the file takes on disk, rather than its apparent size. a segmented download is
+// truncated to the full size up front, see internal.DownloadSegmented, but only what is downloaded takes space.
+func allocatedSize(info os.FileInfo) int64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Blocks * 512
+	}
+	return info.Size()
+}
+
+// sameFilesystem returns the candidates on the filesystem of path, removing the others frees nothing for it.
+func sameFilesystem(path string, candidates []Reclaimable) []Reclaimable {
+	device := func(path string) (uint64, bool) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, false
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return 0, false
+		}
+		return uint64(stat.Dev), true
+	}
+
+	target, ok := device(path)
+	if !ok {
+		return candidates
+	}
+
+	filtered := []Reclaimable{}
+	for _, candidate := range candidates {
+		if dev, ok := device(candidate.Path); ok && dev == target {
+			filtered = append(filtered, candidate)
+		}
+	}
+	return filtered
+}
+
+func toMegabytes(size int64) int64 {
+	if size <= 0 {
+		return 0
+	}
+	return (size + megabyte - 1) / megabyte
+}
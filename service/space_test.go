@@ -0,0 +1,116 @@
+package service_test
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/IceWhaleTech/CasaOS-Installer/service"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanEviction(t *testing.T) {
+	now := time.Now()
+	candidates := []service.Reclaimable{
+		{Path: "old-release", Priority: service.ReclaimRelease, Size: 300, ModTime: now.Add(-2 * time.Hour)},
+		{Path: "new-release", Priority: service.ReclaimRelease, Size: 300, ModTime: now},
+		{Path: "background", Priority: service.ReclaimBackground, Size: 10, ModTime: now},
+		{Path: "part", Priority: service.ReclaimTemp, Size: 50, ModTime: now},
+	}
+
+	paths := func(evict []service.Reclaimable) []string {
+		return lo.Map(evict, func(candidate service.Reclaimable, _ int) string { return candidate.Path })
+	}
+
+	// it fits already
+	evict, err := service.PlanEviction(1000, 500, candidates)
+	assert.NoError(t, err)
+	assert.Empty(t, evict)
+
+	// temp files go first
+	evict, err = service.PlanEviction(500, 540, candidates)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"part"}, paths(evict))
+
+	// then backgrounds, and the oldest release
+	evict, err = service.PlanEviction(500, 800, candidates)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"part", "background", "old-release"}, paths(evict))
+
+	// nothing is removed if it does not fit even so
+	evict, err = service.PlanEviction(500, 2000, candidates)
+	assert.ErrorIs(t, err, service.ErrNotEnoughSpace)
+	assert.Empty(t, evict)
+}
+
+func TestReclaimableSpace(t *testing.T) {
+	config.ServerInfo.CachePath = t.TempDir()
+
+	writeRelease := func(version string, files map[string]int) {
+		releaseDir, err := config.ReleaseDir(codegen.Release{Version: version})
+		assert.NoError(t, err)
+		assert.NoError(t, os.MkdirAll(releaseDir, 0o755))
+		for name, size := range files {
+			assert.NoError(t, os.WriteFile(filepath.Join(releaseDir, name), make([]byte, size), 0o600))
+		}
+	}
+
+	writeRelease("v1.0.0", map[string]int{"zimaos.raucb": 100, "release.yaml": 10})
+	writeRelease("v1.1.0", map[string]int{"zimaos.raucb.part": 40, "zimaos.raucb.part.json": 2})
+	writeRelease("v1.2.0", map[string]int{"zimaos.raucb": 100})
+
+	candidates := service.ReclaimableSpace("v1.2.0")
+
+	sizes := map[string]int64{}
+	for _, candidate := range candidates {
+		rel, err := filepath.Rel(config.ServerInfo.CachePath, candidate.Path)
+		assert.NoError(t, err)
+		sizes[rel] = candidate.Size
+	}
+
+	// the space used, which is in blocks
+	allocated := func(paths ...string) int64 {
+		var size int64
+		for _, path := range paths {
+			info, err := os.Stat(filepath.Join(config.ServerInfo.CachePath, path))
+			assert.NoError(t, err)
+			size += info.Sys().(*syscall.Stat_t).Blocks * 512
+		}
+		return size
+	}
+
+	// the release kept is left out, and partial downloads are not counted twice
+	assert.Equal(t, allocated("releases/v1.0.0/zimaos.raucb", "releases/v1.0.0/release.yaml"), sizes["releases/v1.0.0"])
+	assert.Equal(t, allocated("releases/v1.1.0/zimaos.raucb.part"), sizes["releases/v1.1.0/zimaos.raucb.part"])
+	assert.Equal(t, allocated("releases/v1.1.0/zimaos.raucb.part.json"), sizes["releases/v1.1.0/zimaos.raucb.part.json"])
+	assert.Equal(t, int64(0), sizes["releases/v1.1.0"])
+	assert.NotContains(t, sizes, "releases/v1.2.0")
+}
+
+func TestMakeSpace(t *testing.T) {
+	config.ServerInfo.CachePath = t.TempDir()
+
+	release := codegen.Release{Version: "v1.2.0"}
+
+	// nobody has an exabyte to spare
+	err := service.MakeSpace(release, 1<<60)
+	assert.ErrorIs(t, err, service.ErrNotEnoughSpace)
+	assert.Regexp(t, `need \d+ MB, have \d+ MB`, err.Error())
+
+	assert.NoError(t, service.MakeSpace(release, 1))
+
+	// a segmented download is truncated to the full size up front, which does not take the space yet
+	releaseDir, err := config.ReleaseDir(release)
+	assert.NoError(t, err)
+	part, err := os.Create(filepath.Join(releaseDir, "zimaos.raucb.part"))
+	assert.NoError(t, err)
+	assert.NoError(t, part.Truncate(1<<43))
+	assert.NoError(t, part.Close())
+
+	assert.ErrorIs(t, service.MakeSpace(release, 1<<43), service.ErrNotEnoughSpace)
+}
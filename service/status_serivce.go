@@ -6,8 +6,10 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
 	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
@@ -16,6 +18,7 @@ import (
 	"github.com/IceWhaleTech/CasaOS-Installer/internal"
 	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
 	"github.com/IceWhaleTech/CasaOS-Installer/types"
+	"github.com/samber/lo"
 	"go.uber.org/zap"
 )
 
@@ -29,16 +32,43 @@ type StatusService struct {
 	status           codegen.Status
 	message          string
 	lock             sync.RWMutex
+
+	// the release of the channel, which release is the next step to when intermediate releases are required
+	channelRelease *codegen.Release
+
+	// the limiter of the download in progress, if it is limited
+	downloadLimiter *internal.DownloadLimiter
+
+	// the download in progress, and the one paused by the user. see PauseDownload
+	download       *downloadOperation
+	pausedDownload *downloadOperation
 }
 
 const (
-	DownloadBegin    EventType = "downloadBegin"
-	DownloadEnd      EventType = "downloadEnd"
-	DownloadError    EventType = "downloadError"
+	DownloadBegin EventType = "downloadBegin"
+	DownloadEnd   EventType = "downloadEnd"
+	DownloadError EventType = "downloadError"
+
+	// the download is paused outside of the download windows, and resumed in the next one
+	DownloadPaused  EventType = "downloadPaused"
+	DownloadResumed EventType = "downloadResumed"
+
+	// the download is canceled by the user
+	DownloadCanceled EventType = "downloadCanceled"
+
 	FetchUpdateEnd   EventType = "fetchUpdateEnd"
 	FetchUpdateBegin EventType = "fetchUpdateBegin"
 	FetchUpdateError EventType = "fetchUpdateError"
 
+	// the release manifest is rejected by signature verification
+	FetchUpdateUntrusted EventType = "fetchUpdateUntrusted"
+
+	// the mirror tells the release is not modified since the last check
+	FetchUpdateNotModified EventType = "fetchUpdateNotModified"
+
+	// the release is in the revocation list of the channel
+	ReleaseRevoked EventType = "releaseRevoked"
+
 	Idle         EventType = "idle"
 	InstallEnd   EventType = "installEnd"
 	InstallBegin EventType = "installBegin"
@@ -50,10 +80,21 @@ var EventTypeMapStatus = map[EventType]codegen.Status{
 	DownloadEnd:   {Status: codegen.Idle},
 	DownloadError: {Status: codegen.Idle},
 
+	DownloadPaused:  {Status: codegen.DownloadPaused},
+	DownloadResumed: {Status: codegen.Downloading},
+
+	DownloadCanceled: {Status: codegen.Idle},
+
 	FetchUpdateBegin: {Status: codegen.FetchUpdating},
 	FetchUpdateEnd:   {Status: codegen.Idle},
 	FetchUpdateError: {Status: codegen.Idle},
 
+	FetchUpdateUntrusted: {Status: codegen.FetchError},
+
+	FetchUpdateNotModified: {Status: codegen.Idle},
+
+	ReleaseRevoked: {Status: codegen.Idle},
+
 	InstallBegin: {Status: codegen.Installing},
 	InstallEnd:   {Status: codegen.Idle},
 	InstallError: {Status: codegen.InstallError},
@@ -64,15 +105,29 @@ var EventTypeMapMessageType = map[EventType]message_bus.EventType{
 	FetchUpdateEnd:   common.EventTypeCheckUpdateEnd,
 	FetchUpdateError: common.EventTypeCheckUpdateError,
 
+	FetchUpdateUntrusted: common.EventTypeCheckUpdateError,
+
+	FetchUpdateNotModified: common.EventTypeCheckUpdateNotModified,
+
+	ReleaseRevoked: common.EventTypeReleaseRevoked,
+
 	DownloadBegin: common.EventTypeDownloadUpdateBegin,
 	DownloadEnd:   common.EventTypeDownloadUpdateEnd,
 	DownloadError: common.EventTypeDownloadUpdateError,
 
+	DownloadPaused:  common.EventTypeDownloadUpdatePaused,
+	DownloadResumed: common.EventTypeDownloadUpdateResumed,
+
+	DownloadCanceled: common.EventTypeDownloadUpdateCanceled,
+
 	InstallBegin: common.EventTypeInstallUpdateBegin,
 	InstallEnd:   common.EventTypeInstallUpdateEnd,
 	InstallError: common.EventTypeInstallUpdateError,
 }
 
+// InstallStepDelay is between the steps of InstallDownloadedRelease, so that each status is seen
+var InstallStepDelay = 3 * time.Second
+
 var versionRegexp = regexp.MustCompile(`^v(\d)+\.(\d)+.(\d)+(-(alpha|beta)?(\d)+)?$`)
 
 func NewStatusService(implementService UpdaterServiceInterface, sysRoot string) *StatusService {
@@ -111,12 +166,24 @@ func (r *StatusService) UpdateStatusWithMessage(eventType EventType, eventMessag
 		r.status = EventTypeMapStatus[DownloadEnd]
 	case DownloadError:
 		r.status = EventTypeMapStatus[DownloadError]
+	case DownloadPaused:
+		r.status = EventTypeMapStatus[DownloadPaused]
+	case DownloadResumed:
+		r.status = EventTypeMapStatus[DownloadResumed]
+	case DownloadCanceled:
+		r.status = EventTypeMapStatus[DownloadCanceled]
 	case FetchUpdateBegin:
 		r.status = EventTypeMapStatus[FetchUpdateBegin]
 	case FetchUpdateEnd:
 		r.status = EventTypeMapStatus[FetchUpdateEnd]
 	case FetchUpdateError:
 		r.status = EventTypeMapStatus[FetchUpdateError]
+	case FetchUpdateUntrusted:
+		r.status = EventTypeMapStatus[FetchUpdateUntrusted]
+	case FetchUpdateNotModified:
+		r.status = EventTypeMapStatus[FetchUpdateNotModified]
+	case ReleaseRevoked:
+		r.status = EventTypeMapStatus[ReleaseRevoked]
 	case InstallBegin:
 		r.status = EventTypeMapStatus[InstallBegin]
 	case InstallEnd:
@@ -162,6 +229,10 @@ func (r *StatusService) GetRelease(ctx context.Context, tag string, useCache boo
 	return r.release, nil
 }
 
+func (r *StatusService) GetRevocationList(ctx context.Context, tag string) (*internal.RevocationList, error) {
+	return r.ImplementService.GetRevocationList(ctx, tag)
+}
+
 func (r *StatusService) Launch(sysRoot string) error {
 	// 事实上已经没有migration了，但是为了兼容性， 先留着
 	r.UpdateStatusWithMessage(InstallBegin, types.MIGRATION)
@@ -174,23 +245,35 @@ func (r *StatusService) VerifyRelease(release codegen.Release) (string, error) {
 }
 
 func (r *StatusService) DownloadRelease(ctx context.Context, release codegen.Release, force bool) (string, error) {
-	err := error(nil)
-
 	localStatus, _ := r.GetStatus()
-	if localStatus.Status == codegen.Downloading {
+	if localStatus.Status == codegen.Downloading || localStatus.Status == codegen.DownloadPaused {
 		return "", fmt.Errorf("downloading")
 	}
 	if localStatus.Status == codegen.Installing && ctx.Value(types.Trigger) != types.INSTALL {
 		return "", fmt.Errorf("installing")
 	}
 
+	return r.downloadRelease(ctx, release, force)
+}
+
+// downloadRelease downloads the release under an operation, which can be paused or canceled by the user.
+func (r *StatusService) downloadRelease(ctx context.Context, release codegen.Release, force bool) (string, error) {
+	err := error(nil)
+
+	ctx, operation := r.startDownload(ctx, release)
+	defer func() { r.finishDownload(operation, err) }()
+
 	switch ctx.Value(types.Trigger) {
 	case types.CRON_JOB:
 		r.UpdateStatusWithMessage(DownloadBegin, types.DOWNLOADING)
+		ctx = r.withDownloadLimiter(ctx)
 		defer func() {
-			if err == nil {
+			switch {
+			case err == nil:
 				r.UpdateStatusWithMessage(DownloadEnd, types.READY_TO_UPDATE)
-			} else {
+			case IsDownloadStopped(err):
+				// the status is updated by PauseDownload or CancelDownload
+			default:
 				r.UpdateStatusWithMessage(DownloadError, err.Error())
 			}
 		}()
@@ -198,16 +281,100 @@ func (r *StatusService) DownloadRelease(ctx context.Context, release codegen.Rel
 	case types.INSTALL:
 		r.UpdateStatusWithMessage(InstallBegin, types.DOWNLOADING)
 		defer func() {
-			if err != nil {
+			if err != nil && !IsDownloadStopped(err) {
 				r.UpdateStatusWithMessage(InstallError, err.Error())
 			}
 		}()
 	}
 
+	ctx = internal.WithDownloadProgress(ctx, NewDownloadProgressMeter(r.updateProgress).Update)
+
 	result, err := r.ImplementService.DownloadRelease(ctx, release, force)
+	if cause := context.Cause(ctx); err != nil && IsDownloadStopped(cause) {
+		err = cause
+	}
+
 	return result, err
 }
 
+// withDownloadLimiter limits the download in background by config.DownloadInfo, until LiftDownloadLimits.
+func (r *StatusService) withDownloadLimiter(ctx context.Context) context.Context {
+	windows, err := internal.ParseDownloadWindows(config.DownloadInfo.Windows)
+	if err != nil {
+		logger.Error("error when trying to parse download windows - downloading at any time", zap.Error(err))
+	}
+
+	limiter := internal.NewDownloadLimiter(config.DownloadInfo.MaxRate*1024, windows)
+	limiter.OnPause = func(reason string) {
+		logger.Info("download is paused", zap.String("reason", reason))
+		r.UpdateStatusWithMessage(DownloadPaused, reason)
+	}
+	limiter.OnResume = func() {
+		logger.Info("download is resumed")
+		r.UpdateStatusWithMessage(DownloadResumed, types.DOWNLOADING)
+	}
+
+	r.lock.Lock()
+	r.downloadLimiter = limiter
+	r.lock.Unlock()
+
+	return internal.WithDownloadLimiter(ctx, limiter)
+}
+
+// LiftDownloadLimits removes the limits of the download in progress, when the user asks for the release.
+func (r *StatusService) LiftDownloadLimits() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.downloadLimiter != nil {
+		r.downloadLimiter.Lift()
+	}
+}
+
+// updateProgress keeps the download progress in the status until the status changes, and publishes it.
+func (r *StatusService) updateProgress(progress codegen.DownloadProgress) {
+	r.lock.Lock()
+	if r.status.Status == codegen.Downloading || r.status.Status == codegen.Installing {
+		r.status.Progress = &progress
+	}
+	r.lock.Unlock()
+
+	eta := ""
+	if progress.Eta != nil {
+		eta = strconv.FormatInt(*progress.Eta, 10)
+	}
+
+	go PublishEventWrapper(context.Background(), common.EventTypeDownloadUpdateProgress, map[string]string{
+		common.PropertyTypeDownloaded.Name: strconv.FormatInt(progress.Downloaded, 10),
+		common.PropertyTypeTotal.Name:      strconv.FormatInt(progress.Total, 10),
+		common.PropertyTypeSpeed.Name:      strconv.FormatInt(progress.Speed, 10),
+		common.PropertyTypeETA.Name:        eta,
+	})
+}
+
+// InstallDownloadedRelease extracts, installs and post installs the release downloaded to releasePath, a step at a time.
+func (r *StatusService) InstallDownloadedRelease(releasePath string, release codegen.Release) error {
+	time.Sleep(InstallStepDelay)
+
+	if err := r.ExtractRelease(releasePath, release); err != nil {
+		logger.Error("error while extract release: %s", zap.Error(err))
+		return err
+	}
+	time.Sleep(InstallStepDelay)
+
+	if err := r.Install(release, r.SysRoot); err != nil {
+		logger.Error("error while install system: %s", zap.Error(err))
+		return err
+	}
+
+	if err := r.PostInstall(release, r.SysRoot); err != nil {
+		logger.Error("error while post install system: %s", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
 func (r *StatusService) ExtractRelease(packageFilepath string, release codegen.Release) error {
 	r.UpdateStatusWithMessage(InstallBegin, types.DECOMPRESS)
 	return nil
@@ -279,10 +446,12 @@ func (r *StatusService) CleanUpOldRelease(sysRoot string) error {
 			continue
 		} else {
 			logger.Info("cleanning up", zap.String("dir", dir))
-			whiteList = []string{"zimaos_zimacube-" + version + ".raucb", "checksums.txt"}
+			whiteList = []string{common.ChecksumsTXTFileName, common.ChecksumsOriginFileName}
 
 			//! Important!: 这里不能删除，为了当前版本在重启以后还能看到更新日志弹框
+			// the package of the current version is kept too, as the base of the delta to the next one, see DownloadDelta
 			if !(currentVersion.String() == version) {
+				whiteList = append(whiteList, releasePackageFiles(dir)...)
 				whiteList = append(whiteList, "release.yaml")
 			}
 
@@ -295,13 +464,32 @@ func (r *StatusService) CleanUpOldRelease(sysRoot string) error {
 	return nil
 }
 
+// releasePackageFiles returns the file names of the packages for this device in the release dir.
+// all bundles are kept if the release in the dir cannot be read.
+func releasePackageFiles(releaseDir string) []string {
+	release, err := internal.GetReleaseFromLocal(filepath.Join(releaseDir, common.ReleaseYAMLFileName))
+	if err == nil {
+		if packageURL, err := internal.GetPackageURLByCurrentArch(*release, ""); err == nil {
+			return []string{filepath.Base(packageURL)}
+		}
+	}
+
+	bundles, err := filepath.Glob(filepath.Join(releaseDir, "*.raucb"))
+	if err != nil {
+		logger.Error("error when trying to find bundles in release", zap.Error(err), zap.String("dir", releaseDir))
+		return []string{}
+	}
+
+	return lo.Map(bundles, func(bundle string, _ int) string { return filepath.Base(bundle) })
+}
+
 func (r *StatusService) Cronjob(ctx context.Context, sysRoot string) error {
 	logger.Info("start a check update job")
 
 	ctx = context.WithValue(ctx, types.Trigger, types.CRON_JOB)
 
 	status, _ := r.GetStatus()
-	if status.Status == codegen.Downloading {
+	if status.Status == codegen.Downloading || status.Status == codegen.DownloadPaused {
 		logger.Info("downloading, skip")
 		return nil
 	}
@@ -314,13 +502,50 @@ func (r *StatusService) Cronjob(ctx context.Context, sysRoot string) error {
 	r.UpdateStatusWithMessage(FetchUpdateBegin, types.FETCHING)
 	logger.Info("start to fetch  release ", zap.Any("info", r.Stats()), zap.Any("array", config.ServerInfo.Mirrors))
 
+	// revoked releases are purged first, so that they are not reported as ready to update any more
+	if list, err := r.ImplementService.GetRevocationList(ctx, GetReleaseBranch(sysRoot)); err != nil {
+		logger.Error("error when trying to get revocation list", zap.Error(err))
+	} else {
+		for _, revoked := range PurgeRevokedReleases(*list) {
+			go PublishEventWrapper(context.Background(), common.EventTypeReleaseRevoked, map[string]string{
+				common.PropertyTypeMessage.Name: RevokedError(revoked).Error(),
+			})
+		}
+	}
+
+	ctx, fetchResult := internal.WithFetchResult(ctx)
+
 	release, err := r.ImplementService.GetRelease(ctx, GetReleaseBranch(sysRoot), false)
 	if err != nil {
+		if internal.IsUntrustedRelease(err) {
+			// keep the cached release, the new one is not trusted.
+			r.UpdateStatusWithMessage(FetchUpdateUntrusted, err.Error())
+			logger.Error("release is rejected by signature verification", zap.Error(err))
+			return err
+		}
 		r.UpdateStatusWithMessage(FetchUpdateError, err.Error())
 		logger.Error("error when trying to get release", zap.Error(err))
 		return err
 	}
+	previousRelease, previousStep := r.channelRelease, r.release
+	r.channelRelease = release
 	r.release = release
+
+	if err := CheckRevoked(release.Version); err != nil {
+		r.UpdateStatusWithMessage(ReleaseRevoked, err.Error())
+		logger.Info("the release of the channel is revoked", zap.Error(err))
+		return nil
+	}
+
+	if fetchResult.NotModified {
+		if message, ok := r.settled(previousRelease, previousStep, *release, sysRoot); ok {
+			r.release = previousStep
+			logger.Info("release is not modified since the last check", zap.String("url", fetchResult.URL), zap.String("release version", release.Version))
+			r.UpdateStatusWithMessage(FetchUpdateNotModified, message)
+			return nil
+		}
+	}
+
 	r.UpdateStatusWithMessage(FetchUpdateEnd, types.OUT_OF_DATE)
 
 	logger.Info("get release success", zap.String("release version", release.Version))
@@ -328,6 +553,28 @@ func (r *StatusService) Cronjob(ctx context.Context, sysRoot string) error {
 	// cache release packages if not already cached
 	shouldUpgrade := r.ShouldUpgrade(*release, sysRoot)
 
+	if shouldUpgrade {
+		// the release might have to be reached through intermediate releases, one at a time
+		nextRelease, err := NextUpgradeStep(ctx, GetReleaseBranch(sysRoot), *release, sysRoot)
+		if err != nil {
+			r.UpdateStatusWithMessage(FetchUpdateError, err.Error())
+			logger.Error("error when trying to plan the upgrade", zap.Error(err), zap.String("release version", release.Version))
+			return err
+		}
+
+		if nextRelease.Version != release.Version {
+			if err := CheckRevoked(nextRelease.Version); err != nil {
+				r.UpdateStatusWithMessage(ReleaseRevoked, err.Error())
+				logger.Info("the intermediate release on the way to the release of the channel is revoked", zap.Error(err), zap.String("target version", release.Version))
+				return nil
+			}
+
+			logger.Info("upgrade through an intermediate release", zap.String("target version", release.Version), zap.String("next version", nextRelease.Version))
+			release = nextRelease
+			r.release = release
+		}
+	}
+
 	releaseFilePath := ""
 
 	if shouldUpgrade {
@@ -338,6 +585,10 @@ func (r *StatusService) Cronjob(ctx context.Context, sysRoot string) error {
 		}
 
 		releaseFilePath, err = r.DownloadRelease(ctx, *release, true)
+		if IsDownloadStopped(err) {
+			logger.Info("download is stopped by the user", zap.Error(err))
+			return nil
+		}
 		if err != nil {
 			logger.Error("error when trying to download release", zap.Error(err), zap.String("release file path", releaseFilePath), zap.Any("info", r.Stats()))
 			r.UpdateStatusWithMessage(DownloadError, err.Error())
@@ -378,6 +629,23 @@ func (r *StatusService) Cronjob(ctx context.Context, sysRoot string) error {
 	return nil
 }
 
+// settled returns true with the message of the last check, if the last check has done everything for the release of
+// the channel, i.e. the system is up to date, or the update package of the step to it is downloaded and verified.
+func (r *StatusService) settled(previousRelease *codegen.Release, previousStep *codegen.Release, release codegen.Release, sysRoot string) (string, bool) {
+	if previousRelease == nil || previousStep == nil || previousRelease.Version != release.Version {
+		return "", false
+	}
+
+	if !r.ShouldUpgrade(release, sysRoot) {
+		return types.UP_TO_DATE, true
+	}
+
+	if _, err := r.VerifyRelease(*previousStep); err != nil {
+		return "", false
+	}
+	return types.READY_TO_UPDATE, true
+}
+
 func (r *StatusService) Stats() UpdateServerStats {
 	return r.ImplementService.Stats()
 }
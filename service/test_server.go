@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
 )
 
 var (
@@ -47,6 +48,10 @@ func (r *TestService) GetRelease(ctx context.Context, tag string, useCache bool)
 	}, nil
 }
 
+func (r *TestService) GetRevocationList(ctx context.Context, tag string) (*internal.RevocationList, error) {
+	return &internal.RevocationList{}, nil
+}
+
 func (r *TestService) VerifyRelease(release codegen.Release) (string, error) {
 	return "", nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
 )
 
 // add more info like update count or anything.
@@ -15,6 +16,7 @@ type UpdateServerStats struct {
 
 type UpdaterServiceInterface interface {
 	GetRelease(ctx context.Context, tag string, useCache bool) (*codegen.Release, error)
+	GetRevocationList(ctx context.Context, tag string) (*internal.RevocationList, error)
 	VerifyRelease(release codegen.Release) (string, error)
 	DownloadRelease(ctx context.Context, release codegen.Release, force bool) (string, error)
 	ExtractRelease(packageFilepath string, release codegen.Release) error
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/Masterminds/semver/v3"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+)
+
+var ErrNoUpgradePath = fmt.Errorf("no upgrade path")
+
+// more steps than this is most likely a mistake in the manifests
+const maxUpgradeSteps = 10
+
+// PlanUpgrade returns the releases to install one by one to get from the current version to target, the last one is target.
+// the intermediate releases required by `min_from_version` and `required_intermediate` are fetched from the release index
+// of the channel. the plan is empty if target is not newer than the current version.
+func PlanUpgrade(ctx context.Context, tag string, target codegen.Release, sysRoot string) ([]codegen.Release, error) {
+	currentVersion, err := CurrentReleaseVersion(sysRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	steps := []codegen.Release{}
+
+	release := target
+	for {
+		version, err := semver.NewVersion(NormalizeVersion(release.Version))
+		if err != nil {
+			return nil, err
+		}
+
+		if !IsNewerVersion(currentVersion, version) {
+			break
+		}
+
+		if len(steps) == maxUpgradeSteps {
+			return nil, fmt.Errorf("%w: more than %d steps to %s", ErrNoUpgradePath, maxUpgradeSteps, target.Version)
+		}
+		steps = append([]codegen.Release{release}, steps...)
+
+		if release.MinFromVersion == nil || *release.MinFromVersion == "" {
+			break
+		}
+
+		minFromVersion, err := semver.NewVersion(NormalizeVersion(*release.MinFromVersion))
+		if err != nil {
+			return nil, err
+		}
+
+		if !IsNewerVersion(currentVersion, minFromVersion) {
+			break
+		}
+
+		if release.RequiredIntermediate == nil || *release.RequiredIntermediate == "" {
+			return nil, fmt.Errorf("%w: %s requires %s or later, but %s is installed", ErrNoUpgradePath, release.Version, *release.MinFromVersion, currentVersion.Original())
+		}
+
+		intermediateVersion, err := semver.NewVersion(NormalizeVersion(*release.RequiredIntermediate))
+		if err != nil {
+			return nil, err
+		}
+
+		// the intermediate has to be between the current version and the release, or the plan would never end
+		if !IsNewerVersion(currentVersion, intermediateVersion) || !IsNewerVersion(intermediateVersion, version) {
+			return nil, fmt.Errorf("%w: intermediate %s of %s is not between %s and %s", ErrNoUpgradePath, *release.RequiredIntermediate, release.Version, currentVersion.Original(), release.Version)
+		}
+
+		intermediate, err := GetReleaseByVersion(ctx, tag, *release.RequiredIntermediate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get intermediate %s of %s: %w", *release.RequiredIntermediate, release.Version, err)
+		}
+
+		release = *intermediate
+	}
+
+	logger.Info("upgrade planned", zap.String("target", target.Version), zap.Strings("steps", lo.Map(steps, func(step codegen.Release, _ int) string {
+		return step.Version
+	})))
+
+	return steps, nil
+}
+
+// NextUpgradeStep returns the release to install next on the way to target. it is target itself if no intermediate is required.
+func NextUpgradeStep(ctx context.Context, tag string, target codegen.Release, sysRoot string) (*codegen.Release, error) {
+	// no need to go through the release index
+	if target.MinFromVersion == nil || *target.MinFromVersion == "" {
+		return &target, nil
+	}
+
+	steps, err := PlanUpgrade(ctx, tag, target, sysRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(steps) == 0 {
+		return &target, nil
+	}
+
+	return &steps[0], nil
+}
+
+// GetUpgradePlan returns the plan to get to target, for the API
+func GetUpgradePlan(ctx context.Context, tag string, target codegen.Release, sysRoot string) (codegen.UpgradePlan, error) {
+	currentVersion, err := CurrentReleaseVersion(sysRoot)
+	if err != nil {
+		return codegen.UpgradePlan{}, err
+	}
+
+	steps, err := PlanUpgrade(ctx, tag, target, sysRoot)
+	if err != nil {
+		return codegen.UpgradePlan{}, err
+	}
+
+	return codegen.UpgradePlan{
+		CurrentVersion: currentVersion.Original(),
+		TargetVersion:  target.Version,
+		Steps: lo.Map(steps, func(step codegen.Release, _ int) codegen.UpgradeStep {
+			return codegen.UpgradeStep{
+				Version:      step.Version,
+				ReleaseNotes: lo.ToPtr(step.ReleaseNotes),
+				Important:    step.Important,
+			}
+		}),
+	}, nil
+}
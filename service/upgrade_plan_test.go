@@ -0,0 +1,233 @@
+package service_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IceWhaleTech/CasaOS-Common/utils/logger"
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
+	"github.com/IceWhaleTech/CasaOS-Installer/common/fixtures"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal/config"
+	"github.com/IceWhaleTech/CasaOS-Installer/service"
+	"github.com/IceWhaleTech/CasaOS-Installer/types"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+)
+
+const planIndexYAML = `releases:
+  - version: v1.3.0
+    path: /releases/v1.3.0.txt
+  - version: v1.2.0
+    path: /releases/v1.2.0.txt
+  - version: v1.1.0
+    path: /releases/v1.1.0.txt
+`
+
+func planReleaseYAML(version, extra string) string {
+	return `version: ` + version + `
+release_notes: release ` + version + `
+mirrors:
+  - https://casaos.io
+packages:
+  - path: /zimaos-${VERSION}.raucb
+    architecture: any
+checksums: /checksums.txt
+` + extra
+}
+
+func TestPlanUpgrade(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rauc-index.txt":
+			w.Write([]byte(planIndexYAML))
+		case "/releases/v1.1.0.txt":
+			w.Write([]byte(planReleaseYAML("v1.1.0", "")))
+		case "/releases/v1.2.0.txt":
+			w.Write([]byte(planReleaseYAML("v1.2.0", "min_from_version: v1.1.0\nrequired_intermediate: v1.1.0\n")))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	mirrors := config.ServerInfo.Mirrors
+	defer func() { config.ServerInfo.Mirrors = mirrors }()
+	config.ServerInfo.Mirrors = []string{server.URL + "/"}
+	config.ServerInfo.CachePath = t.TempDir()
+
+	sysRoot := t.TempDir()
+	fixtures.SetLocalRelease(sysRoot, "v1.0.0")
+
+	ctx := context.Background()
+
+	target := codegen.Release{
+		Version:              "v1.3.0",
+		MinFromVersion:       lo.ToPtr("v1.2.0"),
+		RequiredIntermediate: lo.ToPtr("v1.2.0"),
+	}
+
+	versions := func(steps []codegen.Release) []string {
+		return lo.Map(steps, func(step codegen.Release, _ int) string { return step.Version })
+	}
+
+	steps, err := service.PlanUpgrade(ctx, "rauc", target, sysRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1.1.0", "v1.2.0", "v1.3.0"}, versions(steps))
+
+	next, err := service.NextUpgradeStep(ctx, "rauc", target, sysRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.1.0", next.Version)
+
+	plan, err := service.GetUpgradePlan(ctx, "rauc", target, sysRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.0.0", plan.CurrentVersion)
+	assert.Len(t, plan.Steps, 3)
+
+	// the intermediates already installed are skipped
+	fixtures.SetLocalRelease(sysRoot, "v1.2.0")
+	steps, err = service.PlanUpgrade(ctx, "rauc", target, sysRoot)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v1.3.0"}, versions(steps))
+
+	// nothing to do if the target is not newer
+	fixtures.SetLocalRelease(sysRoot, "v1.3.0")
+	steps, err = service.PlanUpgrade(ctx, "rauc", target, sysRoot)
+	assert.NoError(t, err)
+	assert.Empty(t, steps)
+
+	// no way from an old version without an intermediate
+	fixtures.SetLocalRelease(sysRoot, "v1.0.0")
+	_, err = service.PlanUpgrade(ctx, "rauc", codegen.Release{Version: "v1.3.0", MinFromVersion: lo.ToPtr("v1.2.0")}, sysRoot)
+	assert.ErrorIs(t, err, service.ErrNoUpgradePath)
+
+	// the intermediate must be older than the release
+	_, err = service.PlanUpgrade(ctx, "rauc", codegen.Release{Version: "v1.3.0", MinFromVersion: lo.ToPtr("v1.2.0"), RequiredIntermediate: lo.ToPtr("v1.3.0")}, sysRoot)
+	assert.ErrorIs(t, err, service.ErrNoUpgradePath)
+}
+
+// plannedService fetches the release of the channel from releaseURL, and counts the downloads
+type plannedService struct {
+	*service.TestService
+
+	releaseURL string
+	downloads  atomic.Int32
+}
+
+func (s *plannedService) GetRelease(ctx context.Context, tag string, useCache bool) (*codegen.Release, error) {
+	return internal.GetReleaseFrom(ctx, s.releaseURL)
+}
+
+// newPlanServer serves the release index and the releases of TestPlanUpgrade, with v1.3.0 as the release of the
+// channel which has to be reached through v1.2.0
+func newPlanServer() *httptest.Server {
+	modTime := time.Now().Add(-time.Hour)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rauc.txt":
+			w.Header().Set("ETag", `"v1.3.0"`)
+			content := planReleaseYAML("v1.3.0", "min_from_version: v1.2.0\nrequired_intermediate: v1.2.0\n")
+			http.ServeContent(w, r, "rauc.txt", modTime, strings.NewReader(content))
+		case "/rauc-index.txt":
+			w.Write([]byte(planIndexYAML))
+		case "/releases/v1.1.0.txt":
+			w.Write([]byte(planReleaseYAML("v1.1.0", "")))
+		case "/releases/v1.2.0.txt":
+			w.Write([]byte(planReleaseYAML("v1.2.0", "")))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// newPlannedStatusService returns the status service of a device on v1.0.0, which has to upgrade to v1.3.0 of server
+func newPlannedStatusService(t *testing.T, server *httptest.Server) (*service.StatusService, *plannedService, string) {
+	withMirrors(t, server.URL+"/")
+
+	cachePath := config.ServerInfo.CachePath
+	t.Cleanup(func() { config.ServerInfo.CachePath = cachePath })
+	config.ServerInfo.CachePath = t.TempDir()
+
+	sysRoot := t.TempDir()
+	fixtures.SetLocalRelease(sysRoot, "v1.0.0")
+	fixtures.SetZimaOS(sysRoot)
+
+	implementService := &plannedService{
+		TestService: &service.TestService{InstallRAUCHandler: service.AlwaysSuccessInstallHandler, DownloadStatusLock: sync.RWMutex{}},
+		releaseURL:  server.URL + "/rauc.txt",
+	}
+
+	return service.NewStatusService(implementService, sysRoot), implementService, sysRoot
+}
+
+func (s *plannedService) DownloadRelease(ctx context.Context, release codegen.Release, force bool) (string, error) {
+	s.downloads.Add(1)
+
+	releaseDir, err := config.ReleaseDir(release)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(releaseDir, "release.yaml"), nil
+}
+
+func TestCronjobRevokedIntermediate(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	server := newPlanServer()
+	defer server.Close()
+
+	statusService, implementService, sysRoot := newPlannedStatusService(t, server)
+
+	// the release of the channel is fine, the stepping stone to it is not
+	list := &internal.RevocationList{Revoked: []internal.RevokedRelease{{Version: "v1.2.0", Reason: "bricks some boards"}}}
+	assert.NoError(t, internal.WriteRevocationListToLocal(list, service.RevocationListPath()))
+
+	assert.NoError(t, statusService.Cronjob(context.Background(), sysRoot))
+
+	value, msg := statusService.GetStatus()
+	assert.Equal(t, codegen.Idle, value.Status)
+	assert.Contains(t, msg, "bricks some boards")
+	assert.Zero(t, implementService.downloads.Load())
+}
+
+func TestCronjobNotModifiedIntermediate(t *testing.T) {
+	logger.LogInitConsoleOnly()
+
+	server := newPlanServer()
+	defer server.Close()
+
+	statusService, implementService, sysRoot := newPlannedStatusService(t, server)
+
+	ctx := context.Background()
+
+	// the step to the release of the channel is downloaded
+	assert.NoError(t, statusService.Cronjob(ctx, sysRoot))
+	assert.EqualValues(t, 1, implementService.downloads.Load())
+
+	value, msg := statusService.GetStatus()
+	assert.Equal(t, codegen.Idle, value.Status)
+	assert.Equal(t, types.READY_TO_UPDATE, msg)
+
+	// nothing is done again while the release of the channel is not modified
+	assert.NoError(t, statusService.Cronjob(ctx, sysRoot))
+	assert.EqualValues(t, 1, implementService.downloads.Load())
+
+	value, msg = statusService.GetStatus()
+	assert.Equal(t, codegen.Idle, value.Status)
+	assert.Equal(t, types.READY_TO_UPDATE, msg)
+
+	// and the step is still the one to install
+	release, err := statusService.GetRelease(ctx, "rauc", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.2.0", release.Version)
+}
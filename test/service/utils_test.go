@@ -6,7 +6,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/IceWhaleTech/CasaOS-Installer/codegen"
 	"github.com/IceWhaleTech/CasaOS-Installer/common"
+	"github.com/IceWhaleTech/CasaOS-Installer/internal"
 	"github.com/IceWhaleTech/CasaOS-Installer/service"
 	"github.com/Masterminds/semver/v3"
 	"github.com/stretchr/testify/assert"
@@ -77,10 +79,10 @@ func TestVerifyChecksum(t *testing.T) {
 	checksum := strings.Split(string(out), " ")[0]
 
 	// Test the function
-	err = service.VerifyChecksumByFilePath(tmpfile.Name(), checksum)
+	err = internal.VerifyChecksum(tmpfile.Name(), internal.Checksum{Algorithm: codegen.Sha256, Sum: checksum})
 	assert.NoError(t, err)
 
 	// Test the function with wrong checksum
-	err = service.VerifyChecksumByFilePath(tmpfile.Name(), "wrongchecksum")
+	err = internal.VerifyChecksum(tmpfile.Name(), internal.Checksum{Algorithm: codegen.Sha256, Sum: "wrongchecksum"})
 	assert.Error(t, err)
 }